@@ -60,17 +60,21 @@ func (e *enduserService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if strings.HasSuffix(r.URL.Path[1:], ".rdf") {
-		if err := e.metadata.triplestore.DescribeW(rdf.NewNTriplesEncoder(w), rdf.DescSymmetricRecursive, rdf.NewNamedNode(r.URL.Path[1:len(r.URL.Path)-4])); err != nil {
+		g, err := e.metadata.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(r.URL.Path[1:len(r.URL.Path)-4]))
+		if err != nil {
 			log.Printf("%s desribe resource error: %v", r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+		if err := g.EncodeNTriples(w); err != nil {
+			log.Printf("%s encode resource error: %v", r.URL.Path, err)
+		}
 		return
 	}
 
 	if strings.HasSuffix(r.URL.Path[1:], ".svg") {
 		uri := rdf.NewNamedNode(r.URL.Path[1 : len(r.URL.Path)-4])
-		g, err := e.metadata.triplestore.Describe(rdf.DescSymmetricRecursive, uri)
+		g, err := e.metadata.describe(rdf.DescSymmetricRecursive, uri)
 		if err != nil {
 			log.Printf("%s desribe resource error: %v", r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -81,7 +85,7 @@ func (e *enduserService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"isPublishedInSeries": [2]string{"inSeries", "hasNumber"},
 		}
 
-		dot := g.(*memory.Graph).Dot(uri, memory.DotOptions{
+		dot := g.Dot(uri, memory.DotOptions{
 			Base:            "",
 			Inline:          []string{"hasLink", "hasImage"},
 			InlineWithLabel: map[string]string{"hasLiteraryForm": "hasName", "hasLanguage": "hasName", "hasBinding": "hasName"},
@@ -108,6 +112,8 @@ func (e *enduserService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch paths[0] {
 	case "person":
 		e.servePerson(w, r, strings.Join(paths, "/"))
+	case "corporation":
+		e.serveCorporation(w, r, strings.Join(paths, "/"))
 	case "work":
 		if len(paths) != 4 {
 			http.NotFound(w, r)
@@ -140,14 +146,14 @@ func (e *enduserService) serveSearch(w http.ResponseWriter, r *http.Request) {
 }
 
 func (e *enduserService) servePerson(w http.ResponseWriter, r *http.Request, personID string) {
-	g, err := e.metadata.triplestore.Describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(personID))
+	g, err := e.metadata.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(personID))
 	if err != nil {
 		log.Printf("%s desribe resource error: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	var p entity.Person
-	if err := g.(*memory.Graph).Decode(&p, rdf.NewNamedNode(personID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
+	if err := g.Decode(&p, rdf.NewNamedNode(personID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
 		log.Printf("%s decode Person error: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -190,15 +196,36 @@ func (e *enduserService) servePerson(w http.ResponseWriter, r *http.Request, per
 	}
 }
 
+func (e *enduserService) serveCorporation(w http.ResponseWriter, r *http.Request, corporationID string) {
+	g, err := e.metadata.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(corporationID))
+	if err != nil {
+		log.Printf("%s desribe resource error: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var c entity.Corporation
+	if err := g.Decode(&c, rdf.NewNamedNode(corporationID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
+		log.Printf("%s decode Corporation error: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	c.Process()
+
+	if err := templates.ExecuteTemplate(w, "corporation.html", &c); err != nil {
+		log.Printf("%s: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
 func (e *enduserService) servePublication(w http.ResponseWriter, r *http.Request, workID, pubID string) {
-	g, err := e.metadata.triplestore.Describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(workID))
+	g, err := e.metadata.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(workID))
 	if err != nil {
 		log.Printf("%s desribe resource error: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	var wrk entity.WorkWithPublications
-	if err := g.(*memory.Graph).Decode(&wrk, rdf.NewNamedNode(workID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
+	if err := g.Decode(&wrk, rdf.NewNamedNode(workID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
 		log.Printf("%s: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -225,14 +252,14 @@ func (e *enduserService) servePublication(w http.ResponseWriter, r *http.Request
 }
 
 func (e *enduserService) servePublisherSeries(w http.ResponseWriter, r *http.Request, seriesID string) {
-	g, err := e.metadata.triplestore.Describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(seriesID))
+	g, err := e.metadata.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode(seriesID))
 	if err != nil {
 		log.Printf("%s desribe resource error: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	var s entity.PublisherSeries
-	if err := g.(*memory.Graph).Decode(&s, rdf.NewNamedNode(seriesID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
+	if err := g.Decode(&s, rdf.NewNamedNode(seriesID), rdf.NewNamedNode(""), []string{e.lang}); err != nil {
 		log.Printf("%s decode PublisherSeries error: %v", r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -116,6 +116,17 @@ type Person struct {
 	WorksAbout   []WorkWithPublications `rdf:"<<hasSubject"`
 }
 
+type Corporation struct {
+	URI              string                 `rdf:"id"`
+	Name             string                 `rdf:"->hasName"`
+	Aliases          []string               `rdf:">>hasAlternativeName"`
+	ShortDescription string                 `rdf:"->hasShortDescription"`
+	Links            []string               `rdf:">>hasLink"`
+	Works            []WorkWithPublications `rdf:"<<hasAgent;<-hasContribution"`
+	WorksAbout       []WorkWithPublications `rdf:"<<hasSubject"`
+	Publications     []PublicationWithWork  `rdf:"<<hasPublisher"`
+}
+
 type Date struct {
 	Year      int  `rdf:"->hasYear"`
 	YearLower int  `rdf:"->hasYearLower"`
@@ -257,6 +268,16 @@ func (p *Person) Process() {
 	})
 }
 
+func (c *Corporation) CanonicalTitle() string { return c.Name }
+func (c *Corporation) ID() string             { return c.URI }
+func (c *Corporation) Abstract() string       { return c.ShortDescription }
+func (c *Corporation) EntityType() Type       { return TypeCorporation }
+func (c *Corporation) Process() {
+	sort.Slice(c.Publications, func(i, j int) bool {
+		return c.Publications[i].PublishYear > c.Publications[j].PublishYear
+	})
+}
+
 func (p *Person) WorksOriginal() (res []WorkWithPublications) {
 	for _, w := range p.Works {
 		if !w.IsTranslation() {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// graphTriples returns all the triples in g.
+func graphTriples(g *memory.Graph) ([]rdf.Triple, error) {
+	var b bytes.Buffer
+	if err := g.EncodeNTriples(&b); err != nil {
+		return nil, err
+	}
+	var trs []rdf.Triple
+	dec := rdf.NewDecoder(&b)
+	for tr, err := dec.Decode(); err != io.EOF; tr, err = dec.Decode() {
+		if err != nil {
+			return nil, err
+		}
+		trs = append(trs, tr)
+	}
+	return trs, nil
+}
+
+// selectNodes returns the nodes bound to v in the solutions
+// matching the given patterns.
+func selectNodes(g rdf.Graph, v rdf.Variable, patterns ...rdf.TriplePattern) ([]rdf.Node, error) {
+	res, err := g.Select([]rdf.Variable{v}, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return res.AllBound(v), nil
+}
+
+// rewriteGraph returns a graph of the triples trs, where the nodes in subst
+// are replaced by the given nodes.
+func rewriteGraph(trs []rdf.Triple, subst map[rdf.Node]rdf.Node) *memory.Graph {
+	g := memory.NewGraph()
+	for _, tr := range trs {
+		if n, ok := subst[tr.Subject]; ok {
+			tr.Subject = n
+		}
+		if n, ok := subst[tr.Object]; ok {
+			tr.Object = n
+		}
+		g.Insert(tr)
+	}
+	return g
+}
+
+// relabelBlankNodes returns the triples trs with new, unique labels for
+// their blank nodes, so that they are not mixed up with the blank nodes
+// already in the triplestore when inserted.
+func (m *metadataService) relabelBlankNodes(trs []rdf.Triple) []rdf.Triple {
+	// The labels are numbered after an ID which is unique to this call.
+	prefix := "b" + m.nextID("blank") + "n"
+	labels := make(map[rdf.Node]rdf.Node)
+	relabel := func(n rdf.Node) rdf.Node {
+		if _, ok := n.(rdf.BlankNode); !ok {
+			return n
+		}
+		if l, ok := labels[n]; ok {
+			return l
+		}
+		l := rdf.NewBlankNode(prefix + strconv.Itoa(len(labels)))
+		labels[n] = l
+		return l
+	}
+	res := make([]rdf.Triple, len(trs))
+	for i, tr := range trs {
+		res[i] = rdf.Triple{relabel(tr.Subject), tr.Predicate, relabel(tr.Object)}
+	}
+	return res
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"html"
 	"io"
 	"regexp"
 	"strconv"
@@ -23,41 +26,80 @@ const (
 	sourceOpenLibrary
 )
 
+// sourceNames are the names of the sources, as used in the ingest endpoint.
+var sourceNames = map[string]source{
+	"oria":         sourceOria,
+	"nb":           sourceNasjonalbiblioteket,
+	"google":       sourceGoogle,
+	"loc":          sourceLibraryOfCongress,
+	"librarything": sourceLibraryThing,
+	"openlibrary":  sourceOpenLibrary,
+}
+
 func ingestPublication(id rdf.NamedNode, input io.Reader, s source) (*memory.Graph, error) {
 	switch s {
 	case sourceOria:
 		return ingestOria(id, input)
+	case sourceNasjonalbiblioteket:
+		return ingestNasjonalbiblioteket(id, input)
+	case sourceGoogle:
+		return ingestGoogle(id, input)
+	case sourceLibraryOfCongress:
+		return ingestLibraryOfCongress(id, input)
+	case sourceLibraryThing:
+		// LibraryThing records only describe a Work.
+		return ingestLibraryThing(input)
+	case sourceOpenLibrary:
+		return ingestOpenLibrary(id, input)
 	default:
-		panic("ingestPublication: TODO")
+		return nil, fmt.Errorf("ingestPublication: unknown source %d", s)
 	}
 }
 
+// ingestOria ingests a MARC record from Oria. The record can be serialized
+// as MARCXML (optionally wrapped in a SRU response), MARC-in-JSON or ISO 2709.
 func ingestOria(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
-	rec, err := marc.NewDecoder(input, marc.MARCXML).Decode()
+	dec, err := newMARCDecoder(input)
 	if err != nil {
 		return nil, err
 	}
+	rec, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return ingestMARC(id, rec), nil
+}
+
+// ingestMARC maps a MARC record to a graph describing the Publication
+// identified by id, and the Work it is a publication of.
+func ingestMARC(id rdf.NamedNode, rec *marc.Record) *memory.Graph {
 	g := memory.NewGraph()
 
 	// Publication class
 	g.Insert(rdf.Triple{id, rdf.RDFtype, rdf.NewNamedNode("Publication")})
 
-	// Publication ISBN and binding (soft/hardcover)
-	for _, f := range rec.DataFields(marc.Tag020) {
-		for _, sf := range f.Subfield('q') {
-			switch sf {
-			case "ib.", "ib":
-				g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasBinding"), rdf.NewNamedNode("binding/hardback")})
-			case "h":
-				g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasBinding"), rdf.NewNamedNode("binding/paperback")})
+	// Publication ISBNs and binding (soft/hardcover). Each ISBN is recorded
+	// with its own binding, while the binding of the Publication is the
+	// binding of the first ISBN. Cancelled and invalid ISBNs ($z) are
+	// flagged separately.
+	for i, f := range rec.DataFields(marc.Tag020) {
+		binding := marcBinding(f)
+		if binding != "" && i == 0 {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasBinding"), rdf.NewNamedNode(binding)})
+		}
+		for j, sf := range f.Subfield('a') {
+			isbn := insertISBN(g, id, sf)
+			if isbn != "" && binding != "" {
+				bNode := rdf.NewBlankNode("isbnBinding" + strconv.Itoa(i) + "_" + strconv.Itoa(j))
+				g.Insert(
+					rdf.Triple{id, rdf.NewNamedNode("hasISBNBinding"), bNode},
+					rdf.Triple{bNode, rdf.NewNamedNode("hasISBN"), rdf.NewStrLiteral(isbn)},
+					rdf.Triple{bNode, rdf.NewNamedNode("hasBinding"), rdf.NewNamedNode(binding)})
 			}
-			break
 		}
-		for _, sf := range f.Subfield('a') {
-			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasISBN"), rdf.NewStrLiteral(sf)})
-			break
+		for _, sf := range f.Subfield('z') {
+			insertInvalidISBN(g, id, sf)
 		}
-		break
 	}
 
 	// Publication number of pages
@@ -65,7 +107,36 @@ func ingestOria(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
 		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasNumPages"), rdf.NewTypedLiteral(cleanNumber(numPages), rdf.XSDint)})
 	}
 
-	title := marcField(rec, marc.Tag245, 'a')
+	title := trimISBD(marcField(rec, marc.Tag245, 'a'))
+
+	// Publication subtitle
+	if subtitle := trimISBD(marcField(rec, marc.Tag245, 'b')); subtitle != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasSubtitle"), rdf.NewStrLiteral(subtitle)})
+	}
+
+	// Publication edition statement, like "2. utg."
+	for _, f := range rec.DataFields(marc.Tag250) {
+		parts := append(f.Subfield('a'), f.Subfield('b')...)
+		for i := range parts {
+			parts[i] = strings.TrimRight(parts[i], " /:;=,")
+		}
+		if note := strings.Join(parts, " "); note != "" {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasEditionNote"), rdf.NewStrLiteral(note)})
+		}
+		break
+	}
+
+	// Publication summary. The description is rendered as HTML,
+	// so the text is escaped.
+	var summary []string
+	for _, s := range marcFields(rec, marc.Tag520, 'a') {
+		if s = strings.TrimSpace(s); s != "" {
+			summary = append(summary, "<p>"+html.EscapeString(s)+"</p>")
+		}
+	}
+	if len(summary) > 0 {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublisherDescription"), rdf.NewStrLiteral(strings.Join(summary, "\n"))})
+	}
 
 	var lang string
 	if cf, ok := rec.ControlField(marc.Tag008); ok {
@@ -106,36 +177,86 @@ func ingestOria(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
 		}
 	}
 
+	// Work uniform title. A uniform title with a language ($l) is the
+	// original title of a translated work.
+	if !isTranslation {
+		for _, tag := range []marc.DataTag{marc.Tag130, marc.Tag240} {
+			uniform := trimISBD(marcField(rec, tag, 'a'))
+			if uniform == "" {
+				continue
+			}
+			if marcField(rec, tag, 'l') != "" {
+				isTranslation = true
+				origWork = rdf.NewBlankNode("origWork")
+				g.Insert(
+					rdf.Triple{work, rdf.NewNamedNode("isTranslationOf"), origWork},
+					rdf.Triple{origWork, rdf.RDFtype, rdf.NewNamedNode("Work")},
+					rdf.Triple{origWork, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(uniform)})
+			} else {
+				g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasOriginalTitle"), rdf.NewStrLiteral(uniform)})
+			}
+			break
+		}
+	}
+
+	// Persons in the record, by name, so that a person who is both a
+	// contributor and a subject is represented by one node.
+	persons := make(marcPersons)
+
 	// Work main entry
 	for _, f := range rec.DataFields(marc.Tag100) {
 		contrib := rdf.NewBlankNode("mainEntryContrib")
 		agent := rdf.NewBlankNode("mainEntryAgent")
-		for _, s := range f.Subfield('a') {
+		role := marcRole(f)
+		if role == "" {
+			role = "role/author"
+		}
+		if name := marcName(f); name != "" {
 			g.Insert(
 				rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
-				rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+				rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode(role)},
 				rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
 				rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
-				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(reinvertName(s))})
+				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
 		}
 		for _, s := range f.Subfield('d') {
-			years := strings.Split(s, "-")
-			birthDate := rdf.NewBlankNode("mainEntryAgentBirthDate")
-			g.Insert(
-				rdf.Triple{agent, rdf.NewNamedNode("hasBirthDate"), birthDate},
-				rdf.Triple{birthDate, rdf.RDFtype, rdf.NewNamedNode("Date")},
-				rdf.Triple{birthDate, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(cleanNumber(years[0]), rdf.XSDint)})
-			if len(years) == 2 && len(years[1]) > 0 {
-				deathDate := rdf.NewBlankNode("mainEntryAgentDeathDate")
-				g.Insert(
-					rdf.Triple{agent, rdf.NewNamedNode("hasDeathDate"), deathDate},
-					rdf.Triple{deathDate, rdf.RDFtype, rdf.NewNamedNode("Date")},
-					rdf.Triple{deathDate, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(cleanNumber(years[1]), rdf.XSDint)},
-				)
-			}
+			insertLifespan(g, agent, "mainEntryAgent", s)
+		}
+		insertAuthorityIDs(g, agent, f)
+		persons.add(f, agent)
+
+		if isTranslation && role != "role/translator" {
+			g.Insert(rdf.Triple{origWork, rdf.NewNamedNode("hasContribution"), contrib})
+		} else {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib})
 		}
+	}
+
+	// Corporations in the record, by name.
+	corporations := make(map[string]rdf.BlankNode)
 
-		if isTranslation {
+	// Work main entry, corporate name
+	for _, f := range rec.DataFields(marc.Tag110) {
+		name := marcCorporateName(f)
+		if name == "" {
+			continue
+		}
+		contrib := rdf.NewBlankNode("mainEntryCorpContrib")
+		agent := rdf.NewBlankNode("mainEntryCorp")
+		role := marcRole(f)
+		if role == "" {
+			role = "role/author"
+		}
+		g.Insert(
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode(role)},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
+			rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+			rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+		insertAuthorityIDs(g, agent, f)
+		corporations[name] = agent
+
+		if isTranslation && role != "role/translator" {
 			g.Insert(rdf.Triple{origWork, rdf.NewNamedNode("hasContribution"), contrib})
 		} else {
 			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib})
@@ -146,44 +267,243 @@ func ingestOria(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
 	for i, f := range rec.DataFields(marc.Tag700) {
 		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
 		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
-		for _, s := range f.Subfield('a') {
+		if name := marcName(f); name != "" {
 			g.Insert(
 				rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
 				rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
-				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(reinvertName(s))})
+				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+		}
+		for _, s := range f.Subfield('d') {
+			insertLifespan(g, agent, "agent"+strconv.Itoa(i), s)
+		}
+		insertAuthorityIDs(g, agent, f)
+		persons.add(f, agent)
+		g.Insert(rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")})
+		role := marcRole(f)
+		if role != "" {
+			g.Insert(rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode(role)})
+		}
+
+		// Co-authors of a translated work are contributors to the original,
+		// while translators and others contributed to the translation.
+		if isTranslation && role == "role/author" {
+			g.Insert(rdf.Triple{origWork, rdf.NewNamedNode("hasContribution"), contrib})
+		} else {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib})
+		}
+	}
+
+	// Other contributions, corporate names
+	for i, f := range rec.DataFields(marc.Tag710) {
+		name := marcCorporateName(f)
+		if name == "" {
+			continue
+		}
+		contrib := rdf.NewBlankNode("corpContrib" + strconv.Itoa(i))
+		agent, ok := corporations[name]
+		if !ok {
+			agent = rdf.NewBlankNode("corp" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+			insertAuthorityIDs(g, agent, f)
+			corporations[name] = agent
 		}
 		g.Insert(
 			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
-			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")})
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent})
+		if role := marcRole(f); role != "" {
+			g.Insert(rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode(role)})
+		}
 	}
 
-	// Publication publisher and publish-year
-	for _, f := range rec.DataFields(marc.Tag260) {
-		for _, sf := range f.Subfield('c') {
-			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(sf, rdf.XSDint)})
-			break
+	// Publication place, publisher and publish-year, from the publication
+	// statement (264 with indicator 2 = 1) of newer records, or else from 260,
+	// or from the distribution statement (264 with indicator 2 = 2). Copyright
+	// dates (264 with indicator 2 = 4, or like "c2014" in 260) are recorded
+	// separately.
+	statements := marcFieldsInd2(rec, marc.Tag264, "1")
+	if len(statements) == 0 {
+		statements = rec.DataFields(marc.Tag260)
+	}
+	if len(statements) == 0 {
+		statements = marcFieldsInd2(rec, marc.Tag264, "2")
+	}
+	var publishYear, copyrightYear string
+	if len(statements) > 0 {
+		f := statements[0]
+		for i, s := range f.Subfield('a') {
+			if place := marcUnbracket(s); place != "" && !unknownPlaces[strings.ToLower(place)] {
+				bNode := rdf.NewBlankNode("publicationPlace" + strconv.Itoa(i))
+				g.Insert(
+					rdf.Triple{id, rdf.NewNamedNode("hasPubliationPlace"), bNode},
+					rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Place")},
+					rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(place)})
+			}
 		}
-		for _, sf := range f.Subfield('b') {
-			bNode := rdf.NewBlankNode("publisher")
+		if name := marcUnbracket(marcField1(f, 'b')); name != "" && !unknownPublishers[strings.ToLower(name)] {
+			bNode, ok := corporations[name]
+			if !ok {
+				bNode = rdf.NewBlankNode("publisher")
+				g.Insert(
+					rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+					rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+				corporations[name] = bNode
+			}
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode})
+		}
+		for _, s := range f.Subfield('c') {
+			year, copyright := marcPublicationYears(s)
+			if publishYear == "" {
+				publishYear = year
+			}
+			if copyrightYear == "" {
+				copyrightYear = copyright
+			}
+		}
+	}
+	for _, f := range marcFieldsInd2(rec, marc.Tag264, "4") {
+		if copyrightYear == "" {
+			copyrightYear = reFourDigits.FindString(marcField1(f, 'c'))
+		}
+	}
+	if publishYear == "" {
+		// Only a copyright date is given, which then is the best
+		// indication of the year of publication.
+		publishYear = copyrightYear
+	}
+	if publishYear != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(publishYear, rdf.XSDint)})
+	}
+	if copyrightYear != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasCopyrightYear"), rdf.NewTypedLiteral(copyrightYear, rdf.XSDint)})
+	}
+
+	// Publication series. A traced series statement (490 with
+	// indicator 1) is repeated as a controlled heading in 830, which
+	// is preferred when present.
+	inSeries := make(map[string]bool)
+	for _, tag := range []marc.DataTag{marc.Tag830, marc.Tag490} {
+		for i, f := range rec.DataFields(tag) {
+			name := trimISBD(marcField1(f, 'a'))
+			if name == "" || inSeries[name] {
+				continue
+			}
+			if tag == marc.Tag490 && f.Ind1 == "1" && len(rec.DataFields(marc.Tag830)) > 0 {
+				continue
+			}
+			inSeries[name] = true
+			entry := rdf.NewBlankNode("seriesEntry" + string(tag) + strconv.Itoa(i))
+			series := rdf.NewBlankNode("series" + string(tag) + strconv.Itoa(i))
 			g.Insert(
-				rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode},
-				rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Publisher")},
-				rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(sf)})
-			break
+				rdf.Triple{id, rdf.NewNamedNode("isPublishedInSeries"), entry},
+				rdf.Triple{entry, rdf.NewNamedNode("inSeries"), series},
+				rdf.Triple{series, rdf.RDFtype, rdf.NewNamedNode("PublisherSeries")},
+				rdf.Triple{series, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+			if n := cleanNumber(marcField1(f, 'v')); n != "" {
+				g.Insert(rdf.Triple{entry, rdf.NewNamedNode("hasNumber"), rdf.NewTypedLiteral(n, rdf.XSDint)})
+			}
+		}
+	}
+
+	// Work contents. A work with more than one component work, like
+	// a collection of short stories, is a compilation. Component works
+	// are linked to the persons in the record responsible for them.
+	if contents := marcContents(rec); len(contents) > 1 {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("isCompilation"), rdf.NewTypedLiteral("true", rdf.XSDboolean)})
+		for i, c := range contents {
+			part := rdf.NewBlankNode("part" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasPart"), part},
+				rdf.Triple{part, rdf.RDFtype, rdf.NewNamedNode("Work")},
+				rdf.Triple{part, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(c.title)})
+			if agent, ok := persons.findByName(c.responsibility); ok {
+				contrib := rdf.NewBlankNode("part" + strconv.Itoa(i) + "Contrib")
+				g.Insert(
+					rdf.Triple{part, rdf.NewNamedNode("hasContribution"), contrib},
+					rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+					rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+					rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent})
+			}
 		}
-		break
 	}
 
-	// Work literary form
-	for _, s := range marcFields(rec, marc.Tag653, 'a') {
-		if s == "roman" {
+	// Work literary form, from genre/form terms (655) and uncontrolled
+	// terms (653). The coded form in 008 is less specific, so we only
+	// use it if there are no terms.
+	forms := make(map[string]bool)
+	for _, s := range append(marcFields(rec, marc.Tag655, 'a'), marcFields(rec, marc.Tag653, 'a')...) {
+		if form, ok := literaryFormTerms[strings.ToLower(trimISBD(s))]; ok {
+			forms[form] = true
+		}
+	}
+	if cf, ok := rec.ControlField(marc.Tag008); ok && len(forms) == 0 {
+		if form, ok := literaryFormCodes[cf.GetPos(33, 1)]; ok {
+			forms[form] = true
+		}
+	}
+	for form := range forms {
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasLiteraryForm"), rdf.NewNamedNode(form)})
+	}
+
+	// Work subjects
+	for i, f := range rec.DataFields(marc.Tag600) {
+		name := marcName(f)
+		if name == "" {
+			continue
+		}
+		subj, ok := persons.find(f)
+		if !ok {
+			subj = rdf.NewBlankNode("subjectPerson" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Person")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+			for _, s := range f.Subfield('d') {
+				insertLifespan(g, subj, "subjectPerson"+strconv.Itoa(i), s)
+			}
+			insertAuthorityIDs(g, subj, f)
+			persons.add(f, subj)
+		}
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj})
+	}
+	for i, f := range rec.DataFields(marc.Tag610) {
+		name := marcCorporateName(f)
+		if name == "" {
+			continue
+		}
+		subj, ok := corporations[name]
+		if !ok {
+			subj = rdf.NewBlankNode("subjectCorporation" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+			insertAuthorityIDs(g, subj, f)
+			corporations[name] = subj
+		}
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj})
+	}
+	for i, f := range rec.DataFields(marc.Tag650) {
+		if heading := marcHeading(f); heading != "" {
+			subj := rdf.NewBlankNode("topic" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj},
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Topic")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(heading)})
+		}
+	}
+	for i, f := range rec.DataFields(marc.Tag651) {
+		if heading := marcHeading(f); heading != "" {
+			subj := rdf.NewBlankNode("place" + strconv.Itoa(i))
 			g.Insert(
-				rdf.Triple{work, rdf.NewNamedNode("hasLiteraryForm"), rdf.NewNamedNode("form/novel")})
+				rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj},
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Place")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(heading)})
 		}
 	}
-	// TODO C008 Pos 33
 
-	return g, nil
+	return g
 }
 
 func marcField(r *marc.Record, tag marc.DataTag, subfield rune) string {
@@ -202,16 +522,357 @@ func marcFields(r *marc.Record, tag marc.DataTag, subfield rune) (res []string)
 	return res
 }
 
-var reDigits = regexp.MustCompile("[0-9]+")
+// marcFieldsInd2 returns the fields with the given tag and second indicator.
+func marcFieldsInd2(r *marc.Record, tag marc.DataTag, ind2 string) (res []marc.DField) {
+	for _, f := range r.DataFields(tag) {
+		if f.Ind2 == ind2 {
+			res = append(res, f)
+		}
+	}
+	return res
+}
 
-func cleanNumber(s string) string {
-	return reDigits.FindString(s)
+// skipSpace consumes any leading whitespace from r, and returns the
+// first non-whitespace byte without consuming it.
+func skipSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
+
+// marcField1 returns the first subfield with the given code in f,
+// or an empty string if there is none.
+func marcField1(f marc.DField, code rune) string {
+	for _, s := range f.Subfield(code) {
+		return s
+	}
+	return ""
+}
+
+// marcPerson is a person in a MARC record.
+type marcPerson struct {
+	node  rdf.BlankNode
+	dates string
+}
+
+// marcPersons holds the persons in a MARC record, keyed by name.
+type marcPersons map[string][]marcPerson
+
+// add registers the person described by the X00 field f as node.
+func (p marcPersons) add(f marc.DField, node rdf.BlankNode) {
+	name := trimISBD(marcField1(f, 'a'))
+	if name == "" {
+		return
+	}
+	p[name] = append(p[name], marcPerson{node: node, dates: trimISBD(marcField1(f, 'd'))})
+}
+
+// find returns the node of the person described by the X00 field f, if
+// already registered. Persons are the same if they have the same name,
+// and same dates, unless one of them are without dates.
+func (p marcPersons) find(f marc.DField) (node rdf.BlankNode, ok bool) {
+	dates := trimISBD(marcField1(f, 'd'))
+	for _, person := range p[trimISBD(marcField1(f, 'a'))] {
+		if person.dates == dates || person.dates == "" || dates == "" {
+			return person.node, true
+		}
+	}
+	return node, false
+}
+
+// findByName returns the node of the person with the given name in
+// direct order, like "Knut Hamsun", if registered.
+func (p marcPersons) findByName(name string) (node rdf.BlankNode, ok bool) {
+	if name == "" {
+		return node, false
+	}
+	for inverted, persons := range p {
+		if reinvertName(inverted) == name && len(persons) == 1 {
+			return persons[0].node, true
+		}
+	}
+	return node, false
+}
+
+// Binding qualifiers, in lower case and without trailing punctuation,
+// mapped to bindings.
+var bindingTerms = map[string]string{
+	"h":         "binding/paperback",
+	"heftet":    "binding/paperback",
+	"hardback":  "binding/hardback",
+	"hardcover": "binding/hardback",
+	"hbk":       "binding/hardback",
+	"hc":        "binding/hardback",
+	"ib":        "binding/hardback",
+	"innb":      "binding/hardback",
+	"paperback": "binding/paperback",
+	"pbk":       "binding/paperback",
+	"pb":        "binding/paperback",
+}
+
+// marcBinding returns the binding of the ISBN in the 020 field f, from the
+// qualifier ($q), or from a qualifier in parentheses after the ISBN, as in
+// older records. It returns an empty string if there is no known binding.
+func marcBinding(f marc.DField) string {
+	qualifiers := f.Subfield('q')
+	for _, s := range f.Subfield('a') {
+		if i := strings.Index(s, "("); i > 0 {
+			qualifiers = append(qualifiers, strings.Trim(s[i:], "() "))
+		}
+	}
+	for _, q := range qualifiers {
+		if binding, ok := bindingTerms[strings.ToLower(trimISBD(strings.TrimSpace(q)))]; ok {
+			return binding
+		}
+	}
+	return ""
+}
+
+// Places and publishers, in lower case and without brackets or trailing
+// punctuation, which means that the place or publisher is unknown.
+var (
+	unknownPlaces = map[string]bool{
+		"s.l":                                 true,
+		"sine loco":                           true,
+		"sted ukjent":                         true,
+		"place of publication not identified": true,
+	}
+	unknownPublishers = map[string]bool{
+		"s.n":                       true,
+		"sine nomine":               true,
+		"forlag ukjent":             true,
+		"publisher not identified":  true,
+		"utgiver ikke identifisert": true,
+	}
+)
+
+// marcUnbracket returns s without brackets, used for information supplied
+// by the cataloguer, like "[Oslo]", and without trailing ISBD punctuation.
+func marcUnbracket(s string) string {
+	return trimISBD(strings.Trim(trimISBD(s), "[] "))
+}
+
+var reFourDigits = regexp.MustCompile("[0-9]{4}")
+
+// marcPublicationYears returns the year of publication and the copyright
+// year in a date of publication, like "2015", "[2015?]", "c2014" or
+// "2015, cop. 2014".
+func marcPublicationYears(s string) (year, copyright string) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		y := reFourDigits.FindString(part)
+		if y == "" {
+			continue
+		}
+		if strings.HasPrefix(part, "c") || strings.HasPrefix(part, "©") || strings.HasPrefix(part, "[c") {
+			if copyright == "" {
+				copyright = y
+			}
+		} else if year == "" {
+			year = y
+		}
+	}
+	return year, copyright
 }
 
-func reinvertName(s string) string {
-	if i := strings.Index(s, ","); i > 0 {
-		// TODO make it safe from index out of bounds panic
-		return s[i+2:] + " " + s[:i]
+// marcCorporateName returns the name of a corporation in a X10 field,
+// with any subordinate units ($b) separated by ". ".
+func marcCorporateName(f marc.DField) string {
+	var parts []string
+	for _, s := range append(f.Subfield('a'), f.Subfield('b')...) {
+		if s = trimISBD(s); s != "" {
+			parts = append(parts, s)
+		}
 	}
-	return s
+	return strings.Join(parts, ". ")
+}
+
+// marcContent is a component work in a contents note.
+type marcContent struct {
+	title          string
+	responsibility string
+}
+
+// marcContents returns the component works in the contents notes (505) of
+// rec. Enhanced notes have a title ($t) and statement of responsibility ($r)
+// for each component, while basic notes ($a) are on the form
+// "Title / Author -- Title / Author".
+func marcContents(rec *marc.Record) (res []marcContent) {
+	for _, f := range rec.DataFields(marc.Tag505) {
+		for _, s := range f.Subfield('a') {
+			for _, part := range strings.Split(s, "--") {
+				var c marcContent
+				if i := strings.Index(part, " / "); i >= 0 {
+					c.title, c.responsibility = part[:i], trimISBD(strings.TrimSpace(part[i+3:]))
+				} else {
+					c.title = part
+				}
+				if c.title = trimISBD(strings.TrimSpace(c.title)); c.title != "" {
+					res = append(res, c)
+				}
+			}
+		}
+		titles, resps := f.Subfield('t'), f.Subfield('r')
+		for i, t := range titles {
+			c := marcContent{title: trimISBD(strings.TrimSpace(t))}
+			if i < len(resps) && len(resps) == len(titles) {
+				c.responsibility = trimISBD(strings.TrimSpace(resps[i]))
+			}
+			if c.title != "" {
+				res = append(res, c)
+			}
+		}
+	}
+	return res
+}
+
+// marcHeading returns a subject heading from a 6XX field, with
+// subdivisions ($v, $x, $y, $z) separated by " -- ".
+func marcHeading(f marc.DField) string {
+	parts := f.Subfield('a')
+	for _, code := range []rune{'x', 'z', 'y', 'v'} {
+		parts = append(parts, f.Subfield(code)...)
+	}
+	for i := range parts {
+		parts[i] = trimISBD(parts[i])
+	}
+	return strings.Join(parts, " -- ")
+}
+
+// Literary form codes from 008 position 33 (books) mapped to forms.
+var literaryFormCodes = map[string]string{
+	"0": "form/nonfiction",
+	"1": "form/fiction",
+	"d": "form/drama",
+	"e": "form/essay",
+	"f": "form/novel",
+	"h": "form/humor",
+	"i": "form/letters",
+	"j": "form/shortstory",
+	"m": "form/mixed",
+	"p": "form/poetry",
+	"s": "form/speech",
+}
+
+// Genre/form terms, in lower case, mapped to forms. Covers the most
+// common terms from Norwegian catalogues, and from LCGFT.
+var literaryFormTerms = map[string]string{
+	"biografier":       "form/biography",
+	"biography":        "form/biography",
+	"biographies":      "form/biography",
+	"brev":             "form/letters",
+	"correspondence":   "form/letters",
+	"dikt":             "form/poetry",
+	"drama":            "form/drama",
+	"essay":            "form/essay",
+	"essays":           "form/essay",
+	"fiction":          "form/fiction",
+	"humor":            "form/humor",
+	"letters":          "form/letters",
+	"novel":            "form/novel",
+	"novels":           "form/novel",
+	"noveller":         "form/shortstory",
+	"poetry":           "form/poetry",
+	"roman":            "form/novel",
+	"romaner":          "form/novel",
+	"short stories":    "form/shortstory",
+	"skjønnlitteratur": "form/fiction",
+	"skuespill":        "form/drama",
+	"speeches":         "form/speech",
+	"taler":            "form/speech",
+}
+
+// Relator codes (https://www.loc.gov/marc/relators/) mapped to roles.
+var relatorCodes = map[string]string{
+	"aft": "role/afterword",
+	"aui": "role/foreword",
+	"aut": "role/author",
+	"cmp": "role/composer",
+	"ctb": "role/contributor",
+	"edt": "role/editor",
+	"ill": "role/illustrator",
+	"nrt": "role/narrator",
+	"pht": "role/photographer",
+	"trl": "role/translator",
+}
+
+// Relator terms, as used in $e, in lower case and without trailing
+// punctuation, mapped to roles. Covers the English terms from the relator
+// list, and the (abbreviated) terms used in Norwegian catalogues.
+var relatorTerms = map[string]string{
+	"author":                 "role/author",
+	"author of afterword":    "role/afterword",
+	"author of introduction": "role/foreword",
+	"composer":               "role/composer",
+	"contributor":            "role/contributor",
+	"editor":                 "role/editor",
+	"illustrator":            "role/illustrator",
+	"narrator":               "role/narrator",
+	"photographer":           "role/photographer",
+	"translator":             "role/translator",
+
+	"bearb":       "role/editor",
+	"etterord":    "role/afterword",
+	"forf":        "role/author",
+	"forfatter":   "role/author",
+	"forord":      "role/foreword",
+	"foto":        "role/photographer",
+	"fotograf":    "role/photographer",
+	"ill":         "role/illustrator",
+	"illustratør": "role/illustrator",
+	"innl":        "role/foreword",
+	"innleder":    "role/foreword",
+	"innleser":    "role/narrator",
+	"komp":        "role/composer",
+	"komponist":   "role/composer",
+	"overs":       "role/translator",
+	"oversetter":  "role/translator",
+	"red":         "role/editor",
+	"redaktør":    "role/editor",
+}
+
+// marcRole returns the role of the agent in a 1XX/7XX field, from
+// the relator code ($4) or relator term ($e). It returns an empty
+// string if there is no known relator.
+func marcRole(f marc.DField) string {
+	for _, code := range f.Subfield('4') {
+		if role, ok := relatorCodes[strings.TrimSpace(code)]; ok {
+			return role
+		}
+	}
+	for _, term := range f.Subfield('e') {
+		if role, ok := relatorTerms[strings.ToLower(trimISBD(term))]; ok {
+			return role
+		}
+	}
+	return ""
+}
+
+// insertAuthorityIDs inserts the authority record IDs ($0) of the agent
+// described by the field f, like "(NO-TrBIB)98075025".
+func insertAuthorityIDs(g *memory.Graph, agent rdf.BlankNode, f marc.DField) {
+	for _, s := range f.Subfield('0') {
+		if s = strings.TrimSpace(s); s != "" {
+			g.Insert(rdf.Triple{agent, rdf.NewNamedNode("hasAuthorityID"), rdf.NewStrLiteral(s)})
+		}
+	}
+}
+
+// trimISBD removes trailing ISBD punctuation from s.
+func trimISBD(s string) string {
+	return strings.TrimRight(s, " .,:;/=")
+}
+
+var reDigits = regexp.MustCompile("[0-9]+")
+
+func cleanNumber(s string) string {
+	return reDigits.FindString(s)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/knakk/kbp/marc"
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// ingestResult is the result of ingesting a single record in a batch.
+type ingestResult struct {
+	// RecordID is the control number (001) of the source record, if any.
+	RecordID string
+
+	// ID is the URI minted for the Publication.
+	ID rdf.NamedNode
+
+	Graph *memory.Graph
+	Err   error
+}
+
+// marcSources are the sources which records can be ingested in batches
+// of MARC records.
+var marcSources = map[source]bool{
+	sourceOria:                true,
+	sourceNasjonalbiblioteket: true,
+	sourceLibraryOfCongress:   true,
+}
+
+// ingestMARCBatch ingests every MARC record in input, which can be a file
+// or a SRU response in any of the serializations known by newMARCDecoder.
+// A new Publication URI is minted for each record. Errors in single records
+// are reported in the results, and does not stop the batch. ISO 2709 records
+// end with a record terminator, so the batch continues with the next record
+// after one which cannot be decoded. The XML decoder cannot find the next
+// record after a syntax error, so the other serializations end with the
+// first error from the decoder. The returned error is only non-nil if the
+// input cannot be read at all.
+func (m *metadataService) ingestMARCBatch(input io.Reader) ([]ingestResult, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	if b := bytes.TrimLeft(data, " \t\r\n"); len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return m.ingestISO2709Batch(b), nil
+	}
+
+	dec, err := newMARCDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ingestResult
+	for {
+		rec, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			res = append(res, ingestResult{Err: err})
+			break
+		}
+		res = append(res, m.ingestBatchRecord(rec))
+	}
+
+	return res, nil
+}
+
+// ingestISO2709Batch ingests the ISO 2709 records in data, which are decoded
+// one by one, split at the record terminators.
+func (m *metadataService) ingestISO2709Batch(data []byte) []ingestResult {
+	var res []ingestResult
+	for _, b := range bytes.SplitAfter(data, []byte{marcRecordTerminator}) {
+		if b = bytes.TrimLeft(b, " \t\r\n"); len(b) == 0 {
+			continue
+		}
+		rec, err := marc.NewDecoder(bytes.NewReader(b), marc.MARC).Decode()
+		if err == io.EOF {
+			err = errors.New("ingestISO2709Batch: incomplete record")
+		}
+		if err != nil {
+			res = append(res, ingestResult{Err: err})
+			continue
+		}
+		res = append(res, m.ingestBatchRecord(rec))
+	}
+	return res
+}
+
+// ingestBatchRecord ingests a record in a batch, see ingestMARCRecord.
+func (m *metadataService) ingestBatchRecord(rec *marc.Record) ingestResult {
+	r := ingestResult{
+		ID: rdf.NewNamedNode(m.ns + "publication/" + m.nextID("publication")),
+	}
+	if cf, ok := rec.ControlField(marc.Tag001); ok {
+		r.RecordID = strings.TrimSpace(cf.Value)
+	}
+	r.Graph, r.Err = ingestMARCRecord(r.ID, rec)
+	return r
+}
+
+// ingestMARCRecord maps rec like ingestMARC, but checks that the record has
+// the minimum we need, and recovers from any panics in the mapping, so that
+// a malformed record cannot bring down a whole batch.
+func ingestMARCRecord(id rdf.NamedNode, rec *marc.Record) (g *memory.Graph, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			g = nil
+			err = fmt.Errorf("ingestMARCRecord: %v", r)
+		}
+	}()
+	if marcField(rec, marc.Tag245, 'a') == "" {
+		return nil, errors.New("ingestMARCRecord: record has no title (245$a)")
+	}
+	return ingestMARC(id, rec), nil
+}
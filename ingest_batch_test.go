@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+const testMARCBatch = `<?xml version="1.0" encoding="UTF-8"?><searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/">
+  <version>1.2</version>
+  <numberOfRecords>3</numberOfRecords>
+  <records>
+    <record>
+      <recordSchema>marcxml</recordSchema>
+      <recordPacking>xml</recordPacking>
+      <recordData>
+        <record xmlns="">
+          <leader>00715cam a2200241 c 4500</leader>
+          <controlfield tag="001">990114007574702201</controlfield>
+          <datafield tag="245" ind1="1" ind2="0">
+            <subfield code="a">I am a cat</subfield>
+          </datafield>
+        </record>
+      </recordData>
+      <recordPosition>1</recordPosition>
+    </record>
+    <record>
+      <recordSchema>marcxml</recordSchema>
+      <recordPacking>xml</recordPacking>
+      <recordData>
+        <record xmlns="">
+          <leader>00715cam a2200241 c 4500</leader>
+          <controlfield tag="001">990114007574702202</controlfield>
+          <datafield tag="246" ind1="1" ind2=" ">
+            <subfield code="a">Wagahai wa neko de aru</subfield>
+          </datafield>
+        </record>
+      </recordData>
+      <recordPosition>2</recordPosition>
+    </record>
+    <record>
+      <recordSchema>marcxml</recordSchema>
+      <recordPacking>xml</recordPacking>
+      <recordData>
+        <record xmlns="">
+          <leader>00715cam a2200241 c 4500</leader>
+          <controlfield tag="001">990114007574702203</controlfield>
+          <datafield tag="245" ind1="1" ind2="0">
+            <subfield code="a">Kokoro</subfield>
+          </datafield>
+        </record>
+      </recordData>
+      <recordPosition>3</recordPosition>
+    </record>
+  </records>
+</searchRetrieveResponse>`
+
+func TestIngestMARCBatch(t *testing.T) {
+	m := &metadataService{}
+	res, err := m.ingestMARCBatch(bytes.NewBufferString(testMARCBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d results; want 3", len(res))
+	}
+
+	for i, want := range []struct {
+		recordID string
+		ok       bool
+	}{
+		{"990114007574702201", true},
+		{"990114007574702202", false},
+		{"990114007574702203", true},
+	} {
+		got := res[i]
+		if got.RecordID != want.recordID {
+			t.Errorf("result #%d: got record ID %q; want %q", i+1, got.RecordID, want.recordID)
+		}
+		if want.ok && (got.Err != nil || got.Graph == nil) {
+			t.Errorf("result #%d: got error %v; want a graph", i+1, got.Err)
+		}
+		if !want.ok && got.Err == nil {
+			t.Errorf("result #%d: got no error; want an error for record without title", i+1)
+		}
+		if !strings.HasPrefix(got.ID.Name(), "publication/") {
+			t.Errorf("result #%d: got ID %v; want a publication URI", i+1, got.ID)
+		}
+	}
+
+	if res[0].ID == res[2].ID {
+		t.Errorf("got same ID for different records: %v", res[0].ID)
+	}
+}
+
+func TestIngestMARCBatchISO2709(t *testing.T) {
+	var batch bytes.Buffer
+	for i, title := range []string{"I am a cat", "Kokoro"} {
+		rec := marcRecord{leader: marcLeader}
+		rec.addControl("001", "99011400757470220"+strconv.Itoa(i+1)+" ")
+		rec.addData("245", '1', '0', "a", title)
+		if err := rec.encodeISO2709(&batch); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// A record which is cut short cannot be decoded, but the
+			// next record is found after its record terminator.
+			batch.WriteString("00200nam a2200049 c 4500001\x1d\n")
+		}
+	}
+
+	m := &metadataService{}
+	res, err := m.ingestMARCBatch(&batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d results; want 3", len(res))
+	}
+	if res[0].Err != nil || res[2].Err != nil {
+		t.Errorf("got errors %v, %v; want records 1 and 3 ingested", res[0].Err, res[2].Err)
+	}
+	if res[1].Err == nil {
+		t.Errorf("got result %+v; want an error for the malformed record", res[1])
+	}
+	for _, i := range []int{0, 2} {
+		if id := res[i].RecordID; id == "" || strings.TrimSpace(id) != id {
+			t.Errorf("result #%d: got record ID %q; want it trimmed", i+1, id)
+		}
+	}
+}
+
+func TestIngestBatchEndpoint(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	testWantStatus(t, "POST", srv.URL+"/ingest/batch?source=google", testMARCBatch, http.StatusBadRequest)
+	testWantStatus(t, "GET", srv.URL+"/ingest/batch?source=oria", "", http.StatusMethodNotAllowed)
+
+	ingest := func() []batchReport {
+		resp, err := http.Post(srv.URL+"/ingest/batch?source=oria", "application/xml", strings.NewReader(testMARCBatch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got %v; want %v", resp.Status, http.StatusOK)
+		}
+		var reports []batchReport
+		if err := json.NewDecoder(resp.Body).Decode(&reports); err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 3 {
+			t.Fatalf("got %d reports; want 3", len(reports))
+		}
+		if reports[0].Report == nil || reports[2].Report == nil {
+			t.Fatalf("got reports %+v; want records 1 and 3 stored", reports)
+		}
+		if reports[1].Report != nil || reports[1].Error == "" {
+			t.Errorf("got report %+v; want an error for record without title", reports[1])
+		}
+		return reports
+	}
+
+	first := ingest()
+	for _, rep := range first {
+		if rep.Report == nil {
+			continue
+		}
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("t"),
+			rdf.TriplePattern{rdf.NewNamedNode(rep.Report.Publication), rdf.NewNamedNode("hasMainTitle"), rdf.NewVariable("t")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 {
+			t.Errorf("got titles %v of %s; want one", nodes, rep.Report.Publication)
+		}
+	}
+
+	// The records are identified by their control numbers when ingested again.
+	second := ingest()
+	for _, i := range []int{0, 2} {
+		if first[i].Report.Publication != second[i].Report.Publication {
+			t.Errorf("record %s: got %s on second ingest; want %s",
+				first[i].Record, second[i].Report.Publication, first[i].Report.Publication)
+		}
+	}
+}
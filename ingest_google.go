@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// googleVolume represents a volume from the Google Books API
+// (https://www.googleapis.com/books/v1/volumes).
+type googleVolume struct {
+	ID         string `json:"id"`
+	VolumeInfo struct {
+		Title               string   `json:"title"`
+		Subtitle            string   `json:"subtitle"`
+		Authors             []string `json:"authors"`
+		Publisher           string   `json:"publisher"`
+		PublishedDate       string   `json:"publishedDate"`
+		Description         string   `json:"description"`
+		PageCount           int      `json:"pageCount"`
+		Language            string   `json:"language"`
+		IndustryIdentifiers []struct {
+			Type       string `json:"type"`
+			Identifier string `json:"identifier"`
+		} `json:"industryIdentifiers"`
+		ImageLinks map[string]string `json:"imageLinks"`
+	} `json:"volumeInfo"`
+}
+
+// googleVolumes represents a volumes search response from the Google Books API.
+type googleVolumes struct {
+	TotalItems int            `json:"totalItems"`
+	Items      []googleVolume `json:"items"`
+}
+
+// Google Books image links, in order of preference.
+var googleImageSizes = []string{"extraLarge", "large", "medium", "small", "thumbnail", "smallThumbnail"}
+
+// Google Books uses ISO 639-1 language codes, while we use
+// ISO 639-2 (bibliographic) codes, same as MARC.
+var iso6391to6392 = map[string]string{
+	"da": "dan",
+	"de": "ger",
+	"en": "eng",
+	"es": "spa",
+	"fi": "fin",
+	"fr": "fre",
+	"is": "ice",
+	"it": "ita",
+	"ja": "jpn",
+	"nb": "nob",
+	"nl": "dut",
+	"nn": "nno",
+	"no": "nob",
+	"ru": "rus",
+	"sv": "swe",
+}
+
+// ingestGoogle ingests a Google Books volume. The input can be either a
+// single volume, or a volumes search response, in which case the first
+// item is used.
+func ingestGoogle(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	var res struct {
+		googleVolume
+		googleVolumes
+	}
+	if err := json.NewDecoder(input).Decode(&res); err != nil {
+		return nil, err
+	}
+	vol := res.googleVolume
+	if vol.VolumeInfo.Title == "" && len(res.Items) > 0 {
+		vol = res.Items[0]
+	}
+	info := vol.VolumeInfo
+	if info.Title == "" {
+		return nil, errors.New("ingestGoogle: volume has no title")
+	}
+
+	g := memory.NewGraph()
+
+	// Publication class
+	g.Insert(rdf.Triple{id, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+
+	// Publication ISBNs
+	for _, ident := range info.IndustryIdentifiers {
+		switch ident.Type {
+		case "ISBN_10", "ISBN_13":
+			insertISBN(g, id, ident.Identifier)
+		}
+	}
+
+	// Publication number of pages
+	if info.PageCount > 0 {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasNumPages"), rdf.NewTypedLiteral(strconv.Itoa(info.PageCount), rdf.XSDint)})
+	}
+
+	// Publication publisher and publish-year
+	if year := cleanNumber(info.PublishedDate); year != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+	}
+	if info.Publisher != "" {
+		bNode := rdf.NewBlankNode("publisher")
+		g.Insert(
+			rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode},
+			rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+			rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(info.Publisher)})
+	}
+
+	// Publication description and cover image. Any markup in the description
+	// is escaped, as it is displayed as HTML.
+	if desc := strings.TrimSpace(info.Description); desc != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublisherDescription"), rdf.NewStrLiteral("<p>" + html.EscapeString(desc) + "</p>")})
+	}
+	for _, size := range googleImageSizes {
+		if link, ok := info.ImageLinks[size]; ok {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasImage"), rdf.NewNamedNode(link)})
+			break
+		}
+	}
+
+	// Publication title and subtitle
+	g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasMainTitle"), rdf.NewStrLiteral(info.Title)})
+	if info.Subtitle != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasSubtitle"), rdf.NewStrLiteral(info.Subtitle)})
+	}
+
+	lang := iso6391to6392[info.Language]
+
+	work := rdf.NewBlankNode("work")
+	g.Insert(
+		rdf.Triple{id, rdf.NewNamedNode("isPublicationOf"), work},
+		rdf.Triple{work, rdf.RDFtype, rdf.NewNamedNode("Work")})
+	if lang != "" {
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewLangLiteral(info.Title, lang)},
+			rdf.Triple{work, rdf.NewNamedNode("hasLanguage"), rdf.NewNamedNode("lang/" + lang)})
+	} else {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(info.Title)})
+	}
+
+	// Work contributions; Google Books only list authors.
+	for i, name := range info.Authors {
+		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
+		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
+			rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
+			rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+	}
+
+	return g, nil
+}
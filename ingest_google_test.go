@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestIngestGoogleVolume(t *testing.T) {
+	// https://www.googleapis.com/books/v1/volumes?q=isbn:0804810346 (trimmed)
+	const input = `{
+ "kind": "books#volumes",
+ "totalItems": 1,
+ "items": [
+  {
+   "kind": "books#volume",
+   "id": "kXBNAQAAIAAJ",
+   "volumeInfo": {
+    "title": "I Am a Cat",
+    "subtitle": "A Novel",
+    "authors": [
+     "Sōseki Natsume"
+    ],
+    "publisher": "Tuttle Publishing",
+    "publishedDate": "1972-06-15",
+    "description": "A classic of Japanese literature.<script>alert(1)</script>",
+    "industryIdentifiers": [
+     {
+      "type": "ISBN_10",
+      "identifier": "0804810346"
+     },
+     {
+      "type": "ISBN_13",
+      "identifier": "9780804810340"
+     }
+    ],
+    "pageCount": 218,
+    "imageLinks": {
+     "smallThumbnail": "http://books.google.com/books/content?id=kXBNAQAAIAAJ&zoom=5",
+     "thumbnail": "http://books.google.com/books/content?id=kXBNAQAAIAAJ&zoom=1"
+    },
+    "language": "en"
+   }
+  }
+ ]
+}`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasISBN> "0804810346" ;
+	<hasISBN> "9780804810340" ;
+	<hasMainTitle> "I Am a Cat" ;
+	<hasSubtitle> "A Novel" ;
+	<hasPublishYear> "1972"^^xsd:int ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Tuttle Publishing"
+	] ;
+	<hasNumPages> "218"^^xsd:int ;
+	<hasPublisherDescription> "<p>A classic of Japanese literature.&lt;script&gt;alert(1)&lt;/script&gt;</p>" ;
+	<hasImage> <http://books.google.com/books/content?id=kXBNAQAAIAAJ&zoom=1> ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "I Am a Cat"@eng ;
+		<hasLanguage> <lang/eng> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Sōseki Natsume"
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceGoogle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
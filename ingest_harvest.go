@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// harvestEvery harvests the records changed since the last harvest from h,
+// now and then every interval, until stopHarvest is closed. The harvest
+// state is stored in the triplestore under the given name.
+func (m *metadataService) harvestEvery(h *oaiHarvester, name string, interval time.Duration) {
+	for {
+		if err := m.harvestChanges(h, name); err != nil {
+			log.Printf("harvest %s error: %v", name, err)
+		}
+		select {
+		case <-m.stopHarvest:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// harvestChanges harvests the records changed since the last harvest from
+// h. When all the records are harvested, the date of the harvest is stored
+// as the datestamp the next harvest starts from; an interrupted harvest
+// starts over.
+func (m *metadataService) harvestChanges(h *oaiHarvester, name string) error {
+	state := rdf.NewNamedNode(m.ns + "harvest/" + name)
+	from, err := m.lastDatestamp(state)
+	if err != nil {
+		return err
+	}
+	log.Printf("harvest %s from %q", name, from)
+	datestamp, err := h.harvest(from, "", m.harvestRecord)
+	if err != nil {
+		return err
+	}
+	return m.setLastDatestamp(state, datestamp)
+}
+
+// harvestRecord stores a harvested MARC record. The record is identified by
+// the local part of its OAI identifier, which is the control number of the
+// records from Oria, like records ingested by the ingest endpoint. The
+// statements ingested from an earlier version of the record are replaced,
+// or retracted if the record is deleted. Records which cannot be ingested
+// are logged and skipped.
+func (m *metadataService) harvestRecord(rec oaiRecord) error {
+	recordID := oaiRecordID(rec.Header.Identifier)
+	if rec.Deleted() {
+		m.storeMu.Lock()
+		defer m.storeMu.Unlock()
+		return m.retract(sourceOria, recordID)
+	}
+	id := rdf.NewNamedNode(m.ns + "publication/" + m.nextID("publication"))
+	dec, err := newMARCDecoder(bytes.NewReader(rec.Metadata.XML))
+	if err != nil {
+		log.Printf("harvest skipping %s: %v", recordID, err)
+		return nil
+	}
+	marcRec, err := dec.Decode()
+	if err != nil {
+		log.Printf("harvest skipping %s: %v", recordID, err)
+		return nil
+	}
+	g, err := ingestMARCRecord(id, marcRec)
+	if err != nil {
+		log.Printf("harvest skipping %s: %v", recordID, err)
+		return nil
+	}
+
+	_, err = m.ingestRecord(id, g, sourceOria, recordID)
+	return err
+}
+
+// lastDatestamp returns the datestamp stored in the harvest state, if any.
+func (m *metadataService) lastDatestamp(state rdf.NamedNode) (string, error) {
+	g, err := m.triplestore.Describe(rdf.DescForward, state)
+	if err != nil {
+		return "", err
+	}
+	var s struct {
+		Datestamp string `rdf:"->hasDatestamp"`
+	}
+	if err := g.(*memory.Graph).Decode(&s, state, rdf.NewNamedNode(""), nil); err != nil {
+		return "", err
+	}
+	return s.Datestamp, nil
+}
+
+// setLastDatestamp stores the datestamp in the harvest state.
+func (m *metadataService) setLastDatestamp(state rdf.NamedNode, datestamp string) error {
+	where := []rdf.TriplePattern{{state, rdf.NewNamedNode("hasDatestamp"), rdf.NewVariable("d")}}
+	if _, _, err := m.triplestore.Update(where, nil, where); err != nil {
+		return err
+	}
+	_, err := m.triplestore.Insert(rdf.Triple{state, rdf.NewNamedNode("hasDatestamp"), rdf.NewStrLiteral(datestamp)})
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+func TestHarvestChanges(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+
+	from := ""
+	pages := map[string][]string{
+		"": {
+			oaiTestRecord("oai:test:1", "2017-01-02", "Sult"),
+			oaiTestRecord("oai:test:2", "2017-01-03", "Pan"),
+		},
+		"+": {
+			oaiTestRecord("oai:test:3", "2017-01-04", ""),
+		},
+	}
+	srv := oaiTestServer(t, &from, pages)
+	defer srv.Close()
+	h := newOAIHarvester(srv.URL, "")
+
+	publication := func(recordID string) (rdf.Node, string) {
+		uri, ok, err := m.recordPublication(sourceOria, recordID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return nil, ""
+		}
+		var p struct {
+			Title string `rdf:"->hasMainTitle"`
+		}
+		g, err := m.triplestore.Describe(rdf.DescForward, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.(*memory.Graph).Decode(&p, uri, rdf.NewNamedNode(""), nil); err != nil {
+			t.Fatal(err)
+		}
+		return uri, p.Title
+	}
+
+	if err := m.harvestChanges(h, "test"); err != nil {
+		t.Fatal(err)
+	}
+	sult, title := publication("1")
+	if title != "Sult" {
+		t.Errorf("got title %q; want Sult", title)
+	}
+	if _, title := publication("2"); title != "Pan" {
+		t.Errorf("got title %q; want Pan", title)
+	}
+
+	// The next harvest starts from the date of the last one, where record 1
+	// is changed and record 2 is deleted.
+	from = "2017-03-01T12:00:00Z"
+	pages[""] = []string{
+		oaiTestRecord("oai:test:1", "2017-01-05", "Sult og kjærlighet"),
+		oaiTestRecord("oai:test:2", "2017-01-05", ""),
+	}
+	delete(pages, "+")
+	if err := m.harvestChanges(h, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if p, title := publication("1"); p != sult || title != "Sult og kjærlighet" {
+		t.Errorf("got %v %q; want %v \"Sult og kjærlighet\"", p, title, sult)
+	}
+	if p, _ := publication("2"); p != nil {
+		t.Errorf("deleted record still stored as %v", p)
+	}
+
+	state := rdf.NewNamedNode("harvest/test")
+	if datestamp, err := m.lastDatestamp(state); err != nil || datestamp != "2017-03-01T12:00:00Z" {
+		t.Errorf("got last datestamp %q, %v; want 2017-03-01T12:00:00Z", datestamp, err)
+	}
+}
+
+func TestHarvestChangesInterrupted(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+
+	// The pages are not in datestamp order.
+	from := ""
+	srv := oaiTestServer(t, &from, map[string][]string{
+		"": {
+			oaiTestRecord("oai:test:1", "2017-01-05", "Sult"),
+		},
+		"+": {
+			oaiTestRecord("oai:test:2", "2017-01-03", "Pan"),
+		},
+	})
+	defer srv.Close()
+	h := newOAIHarvester(srv.URL, "")
+	h.transport = httpGetterFunc(func(url string) (*http.Response, error) {
+		if strings.Contains(url, "resumptionToken") {
+			return nil, errors.New("connection reset")
+		}
+		return http.Get(url)
+	})
+
+	state := rdf.NewNamedNode("harvest/test")
+	if err := m.harvestChanges(h, "test"); err == nil {
+		t.Fatal("got no error from interrupted harvest")
+	}
+	if datestamp, err := m.lastDatestamp(state); err != nil || datestamp != "" {
+		t.Errorf("got last datestamp %q, %v after interrupted harvest; want none", datestamp, err)
+	}
+
+	// The harvest starts over, and record 2 is not skipped.
+	h.transport = http.DefaultClient
+	if err := m.harvestChanges(h, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, recordID := range []string{"1", "2"} {
+		if _, ok, err := m.recordPublication(sourceOria, recordID); err != nil || !ok {
+			t.Errorf("record %s not stored: %v", recordID, err)
+		}
+	}
+	if datestamp, err := m.lastDatestamp(state); err != nil || datestamp != "2017-03-01T12:00:00Z" {
+		t.Errorf("got last datestamp %q, %v; want 2017-03-01T12:00:00Z", datestamp, err)
+	}
+}
+
+func TestHarvestEveryStop(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+		stopHarvest:   make(chan struct{}),
+	}
+	go m.processIndexingQueue()
+
+	from := ""
+	srv := oaiTestServer(t, &from, map[string][]string{
+		"": {
+			oaiTestRecord("oai:test:1", "2017-01-02", "Sult"),
+		},
+	})
+	defer srv.Close()
+	h := newOAIHarvester(srv.URL, "")
+
+	done := make(chan struct{})
+	go func() {
+		m.harvestEvery(h, "test", time.Hour)
+		close(done)
+	}()
+	close(m.stopHarvest)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("harvestEvery did not return after stopHarvest was closed")
+	}
+}
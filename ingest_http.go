@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knakk/kbp/marc"
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+	"github.com/knakk/mormor/entity"
+)
+
+// ingestReport is the outcome of ingesting a record.
+type ingestReport struct {
+	// Publication is the URI of the ingested Publication.
+	Publication string `json:"publication,omitempty"`
+
+	// Work is the URI of the existing Work which a record describing only
+	// a Work, like the ones from LibraryThing, is added to.
+	Work string `json:"work,omitempty"`
+
+	// MatchedBy is "ISBN" if the Publication is an existing one.
+	MatchedBy string `json:"matchedBy,omitempty"`
+
+	reconciliation
+
+	// Conflicts are the properties of the Publication given different
+	// values by different sources.
+	Conflicts []mergeConflict `json:"conflicts,omitempty"`
+
+	supersedes []superseded
+}
+
+// resource returns the URI of the Publication, or of the Work if the record
+// only describes a Work.
+func (rep *ingestReport) resource() string {
+	if rep.Work != "" {
+		return rep.Work
+	}
+	return rep.Publication
+}
+
+// structuralClasses are the classes of blank nodes which are part of the
+// description of another resource, and are not given URIs of their own.
+var structuralClasses = map[string]bool{
+	"Contribution": true,
+	"Date":         true,
+}
+
+// errWorkNotFound is returned by prepareIngested for a record which only
+// describes a Work, when the Work does not match exactly one existing Work.
+var errWorkNotFound = errors.New("prepareIngested: no existing Work matches the record")
+
+// prepareIngested reconciles the graph g of the Publication id ingested from
+// the source s with the triplestore, gives URIs to the remaining blank node
+// resources, and merges it with what other sources have stated about the
+// Publication, so that it is ready to be stored. The statements about the
+// existing resources it is reconciled with are kept, so that they get the
+// provenance of the ingested record too. A record which only describes a
+// Work, and not the Publication id, is added to the existing Work it
+// matches, and cannot create one. Nothing is written to the triplestore.
+func (m *metadataService) prepareIngested(id rdf.NamedNode, g *memory.Graph, s source) (*memory.Graph, *ingestReport, error) {
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The blank nodes are given unique labels first, as the ones which are
+	// not linked to existing blank nodes are stored as they are.
+	trs = m.relabelBlankNodes(trs)
+	g = rewriteGraph(trs, nil)
+	onlyWork := true
+	for _, tr := range trs {
+		if tr.Subject == id {
+			onlyWork = false
+			break
+		}
+	}
+
+	rep := &ingestReport{}
+	var samePublication []reconciledResource
+	if uri, ok, err := m.samePublication(g, id); err != nil {
+		return nil, nil, err
+	} else if ok {
+		subst := map[rdf.Node]rdf.Node{id: uri}
+		if samePublication, err = m.mapPublicationLinks(g, id, uri, subst); err != nil {
+			return nil, nil, err
+		}
+		g = rewriteGraph(trs, subst)
+		id = uri
+		rep.MatchedBy = "ISBN"
+	}
+
+	g, rec, err := m.reconcile(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec.Matched = append(samePublication, rec.Matched...)
+	if onlyWork {
+		for _, r := range rec.Matched {
+			if r.Type == "Work" {
+				rep.Work = r.URI
+			}
+		}
+		if rep.Work == "" {
+			return nil, nil, errWorkNotFound
+		}
+	}
+	matched := []rdf.NamedNode{id}
+	for _, r := range rec.Matched {
+		matched = append(matched, rdf.NewNamedNode(r.URI))
+	}
+	if g, err = m.linkStructures(g, matched); err != nil {
+		return nil, nil, err
+	}
+	trs, err = graphTriples(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subst := make(map[rdf.Node]rdf.Node)
+	var created []reconciledResource
+	for _, tr := range trs {
+		if tr.Predicate != rdf.RDFtype {
+			continue
+		}
+		_, isBlank := tr.Subject.(rdf.BlankNode)
+		class, isClass := tr.Object.(rdf.NamedNode)
+		if !isBlank || !isClass || structuralClasses[class.Name()] {
+			continue
+		}
+		if _, ok := subst[tr.Subject]; ok {
+			continue
+		}
+		path := strings.ToLower(class.Name()[:1]) + class.Name()[1:]
+		uri := rdf.NewNamedNode(m.ns + path + "/" + m.nextID(path))
+		subst[tr.Subject] = uri
+		created = append(created, reconciledResource{Type: class.Name(), URI: uri.Name()})
+	}
+	if len(subst) > 0 {
+		g = rewriteGraph(trs, subst)
+		for _, r := range created {
+			var named struct {
+				Name string `rdf:"->hasName"`
+			}
+			if err := g.Decode(&named, rdf.NewNamedNode(r.URI), rdf.NewNamedNode(""), nil); err != nil {
+				return nil, nil, err
+			}
+			r.Name = named.Name
+			rec.Created = append(rec.Created, r)
+		}
+	}
+
+	if !onlyWork {
+		rep.Publication = id.Name()
+	}
+	rep.reconciliation = *rec
+
+	g, rep.Conflicts, rep.supersedes, err = m.mergeIngested(g, id, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, rep, nil
+}
+
+// publicationLinks are the properties linking a Publication to the Work and
+// publisher which a matched Publication keeps, with their classes.
+var publicationLinks = []struct{ prop, class string }{
+	{"isPublicationOf", "Work"},
+	{"hasPublisher", "Corporation"},
+}
+
+// mapPublicationLinks adds the Work and publisher of the new Publication id
+// in g to subst, so that they are replaced by the ones of the existing
+// Publication uri it is matched to, rather than being reconciled on their
+// own. It returns the existing resources.
+func (m *metadataService) mapPublicationLinks(g *memory.Graph, id, uri rdf.NamedNode, subst map[rdf.Node]rdf.Node) ([]reconciledResource, error) {
+	v := rdf.NewVariable("v")
+	var res []reconciledResource
+	for _, link := range publicationLinks {
+		existing, err := selectNodes(m.triplestore, v, rdf.TriplePattern{uri, rdf.NewNamedNode(link.prop), v})
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+		target, ok := existing[0].(rdf.NamedNode)
+		if !ok {
+			continue
+		}
+		incoming, err := selectNodes(g, v, rdf.TriplePattern{id, rdf.NewNamedNode(link.prop), v})
+		if err != nil {
+			return nil, err
+		}
+		mapped := false
+		for _, n := range incoming {
+			if _, ok := n.(rdf.BlankNode); ok {
+				subst[n] = target
+				mapped = true
+			}
+		}
+		if !mapped {
+			continue
+		}
+		desc, err := m.triplestore.Describe(rdf.DescForward, target)
+		if err != nil {
+			return nil, err
+		}
+		var named struct {
+			Name string `rdf:"->hasName"`
+		}
+		if err := desc.(*memory.Graph).Decode(&named, target, rdf.NewNamedNode(""), nil); err != nil {
+			return nil, err
+		}
+		res = append(res, reconciledResource{Type: link.class, URI: target.Name(), Name: named.Name, MatchedBy: "publication"})
+	}
+	return res, nil
+}
+
+// prepareRecord prepares the graph g of the Publication id ingested from the
+// given source record, like prepareIngested, but describes the Publication of
+// an earlier ingest of the record instead, if any. Records without IDs are
+// identified by their Publication.
+func (m *metadataService) prepareRecord(id rdf.NamedNode, g *memory.Graph, s source, recordID string) (*memory.Graph, *ingestReport, error) {
+	if recordID != "" {
+		uri, ok, err := m.recordPublication(s, recordID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok && uri != id {
+			trs, err := graphTriples(g)
+			if err != nil {
+				return nil, nil, err
+			}
+			id, g = uri, rewriteGraph(trs, map[rdf.Node]rdf.Node{id: uri})
+		}
+	}
+	return m.prepareIngested(id, g, s)
+}
+
+// ingestRecord prepares and stores the graph g of the Publication id ingested
+// from the given source record, see prepareRecord and storeIngested. Ingests
+// are serialized from the first lookup in the triplestore until the graph is
+// stored, so that concurrent ingests of the same record, Publication or
+// agents cannot each create their own resources.
+func (m *metadataService) ingestRecord(id rdf.NamedNode, g *memory.Graph, s source, recordID string) (*ingestReport, error) {
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+
+	g, rep, err := m.prepareRecord(id, g, s, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if recordID == "" {
+		recordID = rep.resource()
+	}
+	if err := m.storeIngested(g, rep, provenance{source: s, recordID: recordID, time: time.Now()}); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// storeIngested inserts the prepared graph g in the triplestore, with the
+// provenance of its statements, and enqueues the agents and works it describes
+// for indexing. The statements ingested earlier from the same source record
+// are replaced, and so are the values from other sources it supersedes. The
+// caller must hold storeMu since g was prepared.
+func (m *metadataService) storeIngested(g *memory.Graph, rep *ingestReport, prov provenance) error {
+	if err := m.retract(prov.source, prov.recordID); err != nil {
+		return err
+	}
+	for _, sup := range rep.supersedes {
+		if err := m.supersede(rdf.NewNamedNode(rep.Publication), sup); err != nil {
+			return err
+		}
+	}
+	if err := m.insertIngested(g, prov); err != nil {
+		return err
+	}
+	for _, resources := range [][]reconciledResource{rep.Matched, rep.Created, rep.Ambiguous} {
+		for _, r := range resources {
+			uri := rdf.NewNamedNode(r.URI)
+			switch entity.TypeFromURI(uri) {
+			case entity.TypePerson, entity.TypeCorporation, entity.TypeWork:
+				m.indexOnly(uri)
+			}
+		}
+	}
+	return nil
+}
+
+// ingestPreview is the graph an ingest would store, with the outcome of the
+// reconciliation, and the triples which would be added to existing resources.
+type ingestPreview struct {
+	ingestReport
+
+	// NTriples is the graph which would be stored, serialized as N-Triples.
+	NTriples string `json:"ntriples"`
+
+	// Changes are the triples which would be added to the matched
+	// resources, serialized as N-Triples.
+	Changes string `json:"changes"`
+
+	// Summary is a human-readable summary of the ingest.
+	Summary string `json:"summary"`
+}
+
+// previewIngested returns a preview of storing the graph g prepared by
+// prepareIngested.
+func (m *metadataService) previewIngested(g *memory.Graph, rep *ingestReport) (*ingestPreview, error) {
+	p := ingestPreview{ingestReport: *rep}
+	var b bytes.Buffer
+	if err := g.EncodeNTriples(&b); err != nil {
+		return nil, err
+	}
+	p.NTriples = b.String()
+
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, err
+	}
+	existingURIs := make([]rdf.NamedNode, 0, len(rep.Matched)+1)
+	if rep.MatchedBy != "" {
+		existingURIs = append(existingURIs, rdf.NewNamedNode(rep.Publication))
+	}
+	for _, r := range rep.Matched {
+		existingURIs = append(existingURIs, rdf.NewNamedNode(r.URI))
+	}
+	var changes []rdf.Triple
+	for _, uri := range existingURIs {
+		existing := make(map[rdf.Triple]bool)
+		desc, err := m.triplestore.Describe(rdf.DescForward, uri)
+		if err != nil {
+			return nil, err
+		}
+		old, err := graphTriples(desc.(*memory.Graph))
+		if err != nil {
+			return nil, err
+		}
+		for _, tr := range old {
+			existing[tr] = true
+		}
+		for _, tr := range trs {
+			if tr.Subject == uri && !existing[tr] {
+				changes = append(changes, tr)
+			}
+		}
+	}
+	// The new blank nodes linked from the changes, like dates, are
+	// described in full.
+	linked := make(map[rdf.Node]bool)
+	for i := 0; i < len(changes); i++ {
+		o := changes[i].Object
+		if _, ok := o.(rdf.BlankNode); !ok || linked[o] {
+			continue
+		}
+		linked[o] = true
+		for _, tr := range trs {
+			if tr.Subject == o {
+				changes = append(changes, tr)
+			}
+		}
+	}
+	b.Reset()
+	cg := memory.NewGraph()
+	cg.Insert(changes...)
+	if err := cg.EncodeNTriples(&b); err != nil {
+		return nil, err
+	}
+	p.Changes = b.String()
+
+	b.Reset()
+	if rep.Work != "" {
+		fmt.Fprintf(&b, "existing Work %s, %d triples\n", rep.Work, len(trs))
+	} else {
+		fmt.Fprintf(&b, "Publication %s, %d triples\n", rep.Publication, len(trs))
+	}
+	if rep.MatchedBy != "" {
+		fmt.Fprintf(&b, "existing Publication %s, matched by %s\n", rep.Publication, rep.MatchedBy)
+	}
+	for _, r := range rep.Created {
+		fmt.Fprintf(&b, "new %s %s %q\n", r.Type, r.URI, r.Name)
+	}
+	for _, r := range rep.Matched {
+		fmt.Fprintf(&b, "existing %s %s %q, matched by %s\n", r.Type, r.URI, r.Name, r.MatchedBy)
+	}
+	for _, r := range rep.Ambiguous {
+		fmt.Fprintf(&b, "new %s %s %q, ambiguous: %s\n", r.Type, r.URI, r.Name, strings.Join(r.Candidates, ", "))
+	}
+	if len(changes) > 0 {
+		fmt.Fprintf(&b, "%d triples added to existing resources\n", len(changes))
+	}
+	for _, c := range rep.Conflicts {
+		fmt.Fprintf(&b, "conflict in %s: kept %s %s", c.Property, c.Kept.Source, strings.Join(c.Kept.Values, ", "))
+		for _, d := range c.Dropped {
+			fmt.Fprintf(&b, "; dropped %s %s", d.Source, strings.Join(d.Values, ", "))
+		}
+		fmt.Fprintln(&b)
+	}
+	p.Summary = b.String()
+
+	return &p, nil
+}
+
+// serveIngest ingests the record in the request body from the source given
+// by the "source" query parameter, or the record with the ISBN given by the
+// "isbn" query parameter, fetched from Oria, and stores it. It responds with the
+// ingestReport as JSON. With the query parameter "preview=true", nothing
+// is stored, and it responds with an ingestPreview instead.
+//
+// The "record" query parameter identifies the record in the source. MARC
+// records are identified by their control number (001) by default, like
+// harvested records, and other records by the Publication. A record which
+// is ingested again replaces the statements from its last ingest. A record
+// of a Publication which is already stored, with the same ISBN, is merged
+// with it, following the merge rules. A record which only describes a Work,
+// like the ones from LibraryThing, is added to the existing Work it matches,
+// and identified by it; it is not found if there is no such Work.
+func (m *metadataService) serveIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := sourceNames[r.URL.Query().Get("source")]
+	if !ok {
+		http.Error(w, "bad request: unknown source", http.StatusBadRequest)
+		return
+	}
+
+	var data []byte
+	if isbn := r.URL.Query().Get("isbn"); isbn != "" {
+		if s != sourceOria || m.oria == nil {
+			http.Error(w, "bad request: cannot fetch records from source", http.StatusBadRequest)
+			return
+		}
+		rec, err := m.oria.fetchISBN(isbn)
+		if err == errSRUNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("%s fetch ISBN %s error: %v", r.URL.Path, isbn, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		data = rec
+	} else {
+		var err error
+		if data, err = ioutil.ReadAll(r.Body); err != nil {
+			log.Printf("%s read request error: %v", r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	id := rdf.NewNamedNode(m.ns + "publication/" + m.nextID("publication"))
+	recordID := oaiRecordID(r.URL.Query().Get("record"))
+	if recordID == "" && marcSources[s] {
+		recordID = marcRecordID(data)
+	}
+	g, err := ingestPublication(id, bytes.NewReader(data), s)
+	if err != nil {
+		http.Error(w, "bad request: error in record: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if preview, _ := strconv.ParseBool(r.URL.Query().Get("preview")); preview {
+		g, rep, err := m.prepareRecord(id, g, s, recordID)
+		if err == errWorkNotFound {
+			http.Error(w, "not found: no existing Work matches the record", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("%s reconcile error: %v", r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		p, err := m.previewIngested(g, rep)
+		if err != nil {
+			log.Printf("%s preview error: %v", r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+	rep, err := m.ingestRecord(id, g, s, recordID)
+	if err == errWorkNotFound {
+		http.Error(w, "not found: no existing Work matches the record", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("%s store error: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	id = rdf.NewNamedNode(rep.resource())
+	log.Printf("%s ingested %s: created: %d; matched: %d; ambiguous: %d",
+		r.URL.Path, id.Name(), len(rep.Created), len(rep.Matched), len(rep.Ambiguous))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/resource/"+strings.TrimPrefix(id.Name(), m.ns))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rep)
+}
+
+// marcRecordID returns the control number (001) of the MARC record in data,
+// or an empty string if data is not MARC or the record has none.
+func marcRecordID(data []byte) string {
+	dec, err := newMARCDecoder(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	rec, err := dec.Decode()
+	if err != nil {
+		return ""
+	}
+	if cf, ok := rec.ControlField(marc.Tag001); ok {
+		return strings.TrimSpace(cf.Value)
+	}
+	return ""
+}
+
+// batchReport is the outcome of ingesting a record in a batch.
+type batchReport struct {
+	// Record is the control number (001) of the record, if any.
+	Record string `json:"record,omitempty"`
+
+	Report *ingestReport `json:"report,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// serveIngestBatch ingests and stores every MARC record in the request body
+// from the source given by the "source" query parameter. The records are
+// identified by their control numbers, so a record which is ingested again
+// replaces the statements from its last ingest. It responds with a
+// batchReport for each record as JSON, where the records which could not
+// be ingested or stored are reported with their errors.
+func (m *metadataService) serveIngestBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := sourceNames[r.URL.Query().Get("source")]
+	if !ok || !marcSources[s] {
+		http.Error(w, "bad request: unknown source, or not a MARC source", http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.ingestMARCBatch(r.Body)
+	if err != nil {
+		http.Error(w, "bad request: error in batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	reports := make([]batchReport, len(res))
+	for i, rec := range res {
+		reports[i].Record = rec.RecordID
+		if rec.Err != nil {
+			reports[i].Error = rec.Err.Error()
+			continue
+		}
+		rep, err := m.ingestRecord(rec.ID, rec.Graph, s, rec.RecordID)
+		if err != nil {
+			log.Printf("%s store %s error: %v", r.URL.Path, rec.ID.Name(), err)
+			reports[i].Error = err.Error()
+			continue
+		}
+		reports[i].Report = rep
+	}
+	log.Printf("%s ingested %d records", r.URL.Path, len(res))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
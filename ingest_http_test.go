@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+const testIngestRecord = `
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>00642cam a2200217 c 4500</leader>
+  <controlfield tag="001">020124830</controlfield>
+  <controlfield tag="008">020404s2002    no#|||||||||||000|1|nob|d</controlfield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">8205307180</subfield>
+  </datafield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Hamsun, Knut</subfield>
+    <subfield code="d">1859-1952</subfield>
+    <subfield code="0">(NO-TrBIB)90053126</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+  <datafield tag="260" ind1=" " ind2=" ">
+    <subfield code="a">Oslo</subfield>
+    <subfield code="b">Gyldendal</subfield>
+    <subfield code="c">2002</subfield>
+  </datafield>
+  <datafield tag="650" ind1=" " ind2="7">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+</record>`
+
+func TestIngestEndpoint(t *testing.T) {
+	m := &metadataService{
+		triplestore: mustDecode(`
+<person/1> a <Person> ;
+	<hasName> "Knut Hamsun" .`),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	testWantStatus(t, "POST", srv.URL+"/ingest?source=unknown", testIngestRecord, http.StatusBadRequest)
+	testWantStatus(t, "GET", srv.URL+"/ingest?source=oria", "", http.StatusMethodNotAllowed)
+
+	resp := testWantStatus(t, "POST", srv.URL+"/ingest?source=oria", testIngestRecord, http.StatusCreated)
+	var rep ingestReport
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Publication == "" || resp.Header.Get("Location") != "/resource/"+rep.Publication {
+		t.Fatalf("got publication %q and Location %q; want the resource URL",
+			rep.Publication, resp.Header.Get("Location"))
+	}
+	if len(rep.Matched) != 1 || rep.Matched[0].URI != "person/1" {
+		t.Errorf("got matched %+v; want person/1", rep.Matched)
+	}
+
+	// The record is identified by its control number, like harvested records.
+	if uri, ok, err := m.recordPublication(sourceOria, "020124830"); err != nil || !ok || uri.Name() != rep.Publication {
+		t.Errorf("got record 020124830 of %v, %v, %v; want %s", uri, ok, err, rep.Publication)
+	}
+
+	// All entities are given URIs, and are reported as created.
+	created := make(map[string]string)
+	for _, r := range rep.Created {
+		created[r.Type] = r.URI
+	}
+	for _, class := range []string{"Work", "Corporation", "Place", "Topic"} {
+		uri, ok := created[class]
+		if !ok {
+			t.Errorf("no %s reported as created", class)
+			continue
+		}
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("c"),
+			rdf.TriplePattern{rdf.NewNamedNode(uri), rdf.RDFtype, rdf.NewVariable("c")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0] != rdf.NewNamedNode(class) {
+			t.Errorf("%s %s not stored", class, uri)
+		}
+	}
+	blank, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+		rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode("Work")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range blank {
+		if _, ok := n.(rdf.BlankNode); ok {
+			t.Errorf("Work stored as blank node")
+		}
+	}
+
+	// The Publication links to the existing Person through its Work.
+	authors, err := selectNodes(m.triplestore, rdf.NewVariable("a"),
+		rdf.TriplePattern{rdf.NewNamedNode(rep.Publication), rdf.NewNamedNode("isPublicationOf"), rdf.NewVariable("w")},
+		rdf.TriplePattern{rdf.NewVariable("w"), rdf.NewNamedNode("hasContribution"), rdf.NewVariable("c")},
+		rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasAgent"), rdf.NewVariable("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 1 || authors[0] != rdf.NewNamedNode("person/1") {
+		t.Errorf("got authors %v; want <person/1>", authors)
+	}
+
+	// The new Work and the matched Person are indexed.
+	timeout := time.After(1 * time.Second)
+	for _, id := range []string{created["Work"], "person/1"} {
+		for {
+			d, err := m.searchService.Index.Document(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != nil {
+				break
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("%s not indexed after 1 second", id)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
+
+func TestIngestPreview(t *testing.T) {
+	m := &metadataService{
+		triplestore: mustDecode(`
+<person/1> a <Person> ;
+	<hasName> "Knut Hamsun" .`),
+	}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	before, err := graphTriples(m.triplestore.(*memory.Graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := testWantStatus(t, "POST", srv.URL+"/ingest?source=oria&preview=true", testIngestRecord, http.StatusOK)
+	var p ingestPreview
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Matched) != 1 || p.Matched[0].URI != "person/1" || p.Matched[0].Name != "Knut Hamsun" {
+		t.Errorf("got matched %+v; want person/1", p.Matched)
+	}
+
+	// The proposed graph describes the Publication.
+	g := mustDecode(p.NTriples)
+	titles, err := selectNodes(g, rdf.NewVariable("t"),
+		rdf.TriplePattern{rdf.NewNamedNode(p.Publication), rdf.NewNamedNode("hasMainTitle"), rdf.NewVariable("t")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 {
+		t.Errorf("got %d titles in proposed graph; want 1", len(titles))
+	}
+
+	// The authority ID and dates are added to the existing Person.
+	wantChanges := mustDecode(`
+<person/1> <hasAuthorityID> "(NO-TrBIB)90053126" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1859"^^<http://www.w3.org/2001/XMLSchema#int> ] ;
+	<hasDeathDate> [ a <Date> ; <hasYear> "1952"^^<http://www.w3.org/2001/XMLSchema#int> ] .`)
+	if got := mustDecode(p.Changes); !got.Eq(wantChanges) {
+		t.Errorf("got changes:\n%v\nwant:\n%v", mustEncode(got), mustEncode(wantChanges))
+	}
+
+	for _, want := range []string{p.Publication, `existing Person person/1 "Knut Hamsun", matched by name`} {
+		if !strings.Contains(p.Summary, want) {
+			t.Errorf("summary %q does not contain %q", p.Summary, want)
+		}
+	}
+
+	// Nothing is stored.
+	after, err := graphTriples(m.triplestore.(*memory.Graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("got %d triples in triplestore after preview; want %d", len(after), len(before))
+	}
+}
+
+func TestIngestEndpointReingest(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	var reps [2]ingestReport
+	for i := range reps {
+		resp := testWantStatus(t, "POST", srv.URL+"/ingest?source=oria&record=020124830", testIngestRecord, http.StatusCreated)
+		if err := json.NewDecoder(resp.Body).Decode(&reps[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reps[0].Publication != reps[1].Publication {
+		t.Errorf("re-ingest created new publication %s; want %s", reps[1].Publication, reps[0].Publication)
+	}
+
+	// The statements are not duplicated.
+	titles, err := selectNodes(m.triplestore, rdf.NewVariable("st"),
+		rdf.TriplePattern{rdf.NewVariable("st"), rdfSubject, rdf.NewNamedNode(reps[0].Publication)},
+		rdf.TriplePattern{rdf.NewVariable("st"), rdfPredicate, rdf.NewNamedNode("hasMainTitle")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 {
+		t.Errorf("got %d reified titles; want 1", len(titles))
+	}
+}
+
+func TestIngestEndpointSameTopic(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	// Another record by Hamsun, with the same subject (650).
+	other := strings.NewReplacer(
+		`<controlfield tag="001">020124830</controlfield>`, `<controlfield tag="001">020124831</controlfield>`,
+		`<subfield code="a">8205307180</subfield>`, `<subfield code="a">8205307199</subfield>`,
+		`<subfield code="a">Sult</subfield>
+  </datafield>
+  <datafield tag="260"`, `<subfield code="a">Mysterier</subfield>
+  </datafield>
+  <datafield tag="260"`,
+	).Replace(testIngestRecord)
+
+	var reps [2]ingestReport
+	for i, record := range []string{testIngestRecord, other} {
+		resp, err := http.Post(srv.URL+"/ingest?source=oria", "application/xml", strings.NewReader(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("got %v; want %v", resp.Status, http.StatusCreated)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&reps[i])
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reps[0].Publication == reps[1].Publication {
+		t.Fatalf("got same publication %s for both records", reps[0].Publication)
+	}
+
+	topics, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+		rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode("Topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 1 {
+		t.Errorf("got topics %v; want one", topics)
+	}
+	var matched bool
+	for _, r := range reps[1].Matched {
+		if r.Type == "Topic" && r.Name == "Sult" && r.MatchedBy == "name" {
+			matched = true
+		}
+	}
+	if !matched {
+		t.Errorf("got matched %+v; want the topic Sult matched by name", reps[1].Matched)
+	}
+}
+
+func TestIngestEndpointReingestChanged(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	// The record is corrected in Oria: the title was in lower case, and
+	// the year of death was wrong.
+	old := strings.Replace(testIngestRecord, `<subfield code="d">1859-1952</subfield>`, `<subfield code="d">1859-1953</subfield>`, 1)
+	old = strings.Replace(old, `<datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>`, `<datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">sult</subfield>`, 1)
+	var reps [2]ingestReport
+	for i, data := range []string{old, testIngestRecord} {
+		resp := testWantStatus(t, "POST", srv.URL+"/ingest?source=oria", data, http.StatusCreated)
+		if err := json.NewDecoder(resp.Body).Decode(&reps[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reps[0].Publication != reps[1].Publication {
+		t.Errorf("re-ingest created new publication %s; want %s", reps[1].Publication, reps[0].Publication)
+	}
+
+	// The old values are replaced, also on the Work and Person the new
+	// version of the record is matched to.
+	titles, err := selectNodes(m.triplestore, rdf.NewVariable("t"),
+		rdf.TriplePattern{rdf.NewNamedNode(reps[1].Publication), rdf.NewNamedNode("hasMainTitle"), rdf.NewVariable("t")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 || titles[0] != rdf.NewStrLiteral("Sult") {
+		t.Errorf("got titles %v; want Sult", titles)
+	}
+	for _, class := range []string{"Work", "Person"} {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+			rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode(class)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 {
+			t.Fatalf("got %s %v; want one", class, nodes)
+		}
+		names, err := selectNodes(m.triplestore, rdf.NewVariable("name"),
+			rdf.TriplePattern{nodes[0], rdf.NewNamedNode("hasName"), rdf.NewVariable("name")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 {
+			t.Errorf("got names %v of %s; want the new one", names, class)
+		}
+	}
+	years, err := selectNodes(m.triplestore, rdf.NewVariable("y"),
+		rdf.TriplePattern{rdf.NewVariable("p"), rdf.NewNamedNode("hasDeathDate"), rdf.NewVariable("d")},
+		rdf.TriplePattern{rdf.NewVariable("d"), rdf.NewNamedNode("hasYear"), rdf.NewVariable("y")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(years) != 1 || years[0] != rdf.NewTypedLiteral("1952", rdf.XSDint) {
+		t.Errorf("got years of death %v; want 1952", years)
+	}
+}
+
+func TestIngestEndpointSameISBN(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	var reps [2]ingestReport
+	for i, s := range []string{"oria", "nb"} {
+		resp := testWantStatus(t, "POST", srv.URL+"/ingest?source="+s, testIngestRecord, http.StatusCreated)
+		if err := json.NewDecoder(resp.Body).Decode(&reps[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The record from the second source describes the same Publication.
+	if reps[1].Publication != reps[0].Publication || reps[1].MatchedBy != "ISBN" {
+		t.Errorf("got publication %s matched by %q; want %s matched by ISBN",
+			reps[1].Publication, reps[1].MatchedBy, reps[0].Publication)
+	}
+	if len(reps[1].Conflicts) != 0 {
+		t.Errorf("got conflicts %+v; want none for the same record", reps[1].Conflicts)
+	}
+
+	// The Work and publisher of the existing Publication are kept.
+	for _, class := range []string{"Work", "Corporation"} {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+			rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode(class)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 {
+			t.Errorf("got %s %v; want one", class, nodes)
+		}
+	}
+	for _, r := range reps[1].Created {
+		if r.Type == "Work" || r.Type == "Corporation" {
+			t.Errorf("got created %+v; want the existing %s", r, r.Type)
+		}
+	}
+}
+
+func TestIngestEndpointDifferentRecords(t *testing.T) {
+	m := &metadataService{
+		triplestore:   memory.NewGraph(),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	records := []struct {
+		recordID, isbn, author, name, title string
+	}{
+		{"020124830", "8205307180", "Hamsun, Knut", "Knut Hamsun", "Sult"},
+		{"991234567", "8203188477", "Undset, Sigrid", "Sigrid Undset", "Kristin Lavransdatter"},
+	}
+	var reps [2]ingestReport
+	for i, rec := range records {
+		data := `<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>00642cam a2200217 c 4500</leader>
+  <controlfield tag="001">` + rec.recordID + `</controlfield>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">` + rec.isbn + `</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">` + rec.author + `</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="0"><subfield code="a">` + rec.title + `</subfield></datafield>
+</record>`
+		resp := testWantStatus(t, "POST", srv.URL+"/ingest?source=oria", data, http.StatusCreated)
+		if err := json.NewDecoder(resp.Body).Decode(&reps[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, rec := range records {
+		// The Work has only its own author, even if the blank nodes of the
+		// records had the same labels.
+		names, err := selectNodes(m.triplestore, rdf.NewVariable("name"),
+			rdf.TriplePattern{rdf.NewNamedNode(reps[i].Publication), rdf.NewNamedNode("isPublicationOf"), rdf.NewVariable("w")},
+			rdf.TriplePattern{rdf.NewVariable("w"), rdf.NewNamedNode("hasContribution"), rdf.NewVariable("c")},
+			rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasAgent"), rdf.NewVariable("a")},
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.NewNamedNode("hasName"), rdf.NewVariable("name")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != rdf.NewStrLiteral(rec.name) {
+			t.Errorf("got authors %v of %s; want %s", names, rec.title, rec.name)
+		}
+
+		// The reified statements of the record are about its own resources.
+		where := recordStatement(sourceOria, rec.recordID)
+		where[3].Object = rdf.NewNamedNode("hasMainTitle")
+		titles, err := selectNodes(m.triplestore, rdf.NewVariable("o"), where...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(titles) != 1 || titles[0] != rdf.NewStrLiteral(rec.title) {
+			t.Errorf("got titles %v from record %s; want %s", titles, rec.recordID, rec.title)
+		}
+		agents, err := selectNodes(m.triplestore, rdf.NewVariable("o"), append(recordStatement(sourceOria, rec.recordID),
+			rdf.TriplePattern{rdf.NewVariable("st"), rdfPredicate, rdf.NewNamedNode("hasAgent")})...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(agents) != 1 {
+			t.Errorf("got agents %v from record %s; want one", agents, rec.recordID)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// ltWork represents a work with Common Knowledge fields, as returned by the
+// LibraryThing web service method librarything.ck.getwork.
+type ltWork struct {
+	Authors []string `xml:"ltml>item>author"`
+	Title   string   `xml:"ltml>item>title"`
+	Fields  []struct {
+		Name     string `xml:"name,attr"`
+		Versions []struct {
+			Facts []string `xml:"factList>fact"`
+		} `xml:"versionList>version"`
+	} `xml:"ltml>item>commonknowledge>fieldList>field"`
+}
+
+// facts returns the facts of the current version of the named Common Knowledge field.
+func (w ltWork) facts(name string) []string {
+	for _, f := range w.Fields {
+		if f.Name == name && len(f.Versions) > 0 {
+			res := make([]string, 0, len(f.Versions[0].Facts))
+			for _, fact := range f.Versions[0].Facts {
+				if fact = strings.TrimSpace(fact); fact != "" {
+					res = append(res, fact)
+				}
+			}
+			return res
+		}
+	}
+	return nil
+}
+
+// Language names, as used by LibraryThing, mapped to ISO 639-2 (bibliographic) codes.
+var languageNames = map[string]string{
+	"Danish":              "dan",
+	"Dutch":               "dut",
+	"English":             "eng",
+	"Finnish":             "fin",
+	"French":              "fre",
+	"German":              "ger",
+	"Icelandic":           "ice",
+	"Italian":             "ita",
+	"Japanese":            "jpn",
+	"Norwegian":           "nob",
+	"Norwegian (Bokmål)":  "nob",
+	"Norwegian (Nynorsk)": "nno",
+	"Russian":             "rus",
+	"Spanish":             "spa",
+	"Swedish":             "swe",
+}
+
+// reSeriesNumber matches a series fact with a number, like "Discworld (1)".
+var reSeriesNumber = regexp.MustCompile(`^(.+?)\s*\(([0-9]+)\)$`)
+
+// ingestLibraryThing ingests a LibraryThing work with Common Knowledge fields.
+// LibraryThing describes works, not editions, so the resulting graph only
+// describes a Work, with its title and authors, so that it can be matched to
+// an existing Work which the facts are added to.
+func ingestLibraryThing(input io.Reader) (*memory.Graph, error) {
+	var lt ltWork
+	if err := xml.NewDecoder(input).Decode(&lt); err != nil {
+		return nil, err
+	}
+	if lt.Title == "" {
+		return nil, errors.New("ingestLibraryThing: work has no title")
+	}
+
+	g := memory.NewGraph()
+
+	// Work class and title
+	work := rdf.NewBlankNode("work")
+	g.Insert(
+		rdf.Triple{work, rdf.RDFtype, rdf.NewNamedNode("Work")},
+		rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(lt.Title)})
+
+	// Work original title and language
+	for _, s := range lt.facts("originaltitle") {
+		if s != lt.Title {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasOriginalTitle"), rdf.NewStrLiteral(s)})
+		}
+		break
+	}
+	for _, s := range lt.facts("originallanguage") {
+		if lang, ok := languageNames[s]; ok {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasOriginalLanguage"), rdf.NewNamedNode("lang/" + lang)})
+		}
+		break
+	}
+
+	// Work first publication date
+	for _, s := range lt.facts("originalpublicationdate") {
+		years := reYear.FindAllString(s, 2)
+		if len(years) == 0 {
+			continue
+		}
+		date := rdf.NewBlankNode("firstPublicationDate")
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasFirstPublicationDate"), date},
+			rdf.Triple{date, rdf.RDFtype, rdf.NewNamedNode("Date")})
+		if len(years) == 2 {
+			g.Insert(
+				rdf.Triple{date, rdf.NewNamedNode("hasYearLower"), rdf.NewTypedLiteral(years[0], rdf.XSDint)},
+				rdf.Triple{date, rdf.NewNamedNode("hasYearUpper"), rdf.NewTypedLiteral(years[1], rdf.XSDint)})
+		} else {
+			g.Insert(rdf.Triple{date, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(years[0], rdf.XSDint)})
+		}
+		break
+	}
+
+	// Work series
+	for i, s := range lt.facts("series") {
+		entry := rdf.NewBlankNode("seriesEntry" + strconv.Itoa(i))
+		series := rdf.NewBlankNode("series" + strconv.Itoa(i))
+		name := s
+		if m := reSeriesNumber.FindStringSubmatch(s); m != nil {
+			name = m[1]
+			g.Insert(rdf.Triple{entry, rdf.NewNamedNode("hasNumber"), rdf.NewTypedLiteral(m[2], rdf.XSDint)})
+		}
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("isPublishedInSeries"), entry},
+			rdf.Triple{entry, rdf.NewNamedNode("inSeries"), series},
+			rdf.Triple{series, rdf.RDFtype, rdf.NewNamedNode("PublisherSeries")},
+			rdf.Triple{series, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+	}
+
+	// Work characters and places
+	for _, s := range lt.facts("characternames") {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasCharacter"), rdf.NewStrLiteral(s)})
+	}
+	for i, s := range lt.facts("placesmentioned") {
+		place := rdf.NewBlankNode("place" + strconv.Itoa(i))
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasPlace"), place},
+			rdf.Triple{place, rdf.RDFtype, rdf.NewNamedNode("Place")},
+			rdf.Triple{place, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(s)})
+	}
+
+	// Work contributions
+	for i, name := range lt.Authors {
+		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
+		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
+			rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
+			rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(strings.TrimSpace(name))})
+	}
+
+	return g, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestIngestLibraryThing(t *testing.T) {
+	// http://www.librarything.com/services/rest/1.1/?method=librarything.ck.getwork&isbn=0804810346 (trimmed)
+	const input = `<?xml version="1.0" encoding="UTF-8"?>
+<response stat="ok">
+  <ltml xmlns="http://www.librarything.com/" version="1.1">
+    <item id="152937" type="work">
+      <author id="26358" authorcode="natsumesoseki">Soseki Natsume</author>
+      <title>I Am a Cat</title>
+      <commonknowledge>
+        <fieldList>
+          <field type="16" name="originalpublicationdate" displayName="Original publication date">
+            <versionList>
+              <version id="2391452" archived="0" lang="eng">
+                <factList>
+                  <fact>1905-1906</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="42" name="series" displayName="Series">
+            <versionList>
+              <version id="3910242" archived="0" lang="eng">
+                <factList>
+                  <fact>Tuttle Classics (12)</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="3" name="characternames" displayName="People/Characters">
+            <versionList>
+              <version id="1202944" archived="0" lang="eng">
+                <factList>
+                  <fact>Mr. Sneaze</fact>
+                  <fact>Waverhouse</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="2" name="placesmentioned" displayName="Important places">
+            <versionList>
+              <version id="1202945" archived="0" lang="eng">
+                <factList>
+                  <fact>Tokyo, Japan</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="21" name="originaltitle" displayName="Original title">
+            <versionList>
+              <version id="1202946" archived="0" lang="eng">
+                <factList>
+                  <fact>Wagahai wa neko de aru</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="47" name="originallanguage" displayName="Original language">
+            <versionList>
+              <version id="1202947" archived="0" lang="eng">
+                <factList>
+                  <fact>Japanese</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+        </fieldList>
+      </commonknowledge>
+    </item>
+  </ltml>
+</response>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+_:work a <Work> ;
+	<hasName> "I Am a Cat" ;
+	<hasOriginalTitle> "Wagahai wa neko de aru" ;
+	<hasOriginalLanguage> <lang/jpn> ;
+	<hasFirstPublicationDate> [
+		a <Date> ;
+		<hasYearLower> "1905"^^xsd:int ;
+		<hasYearUpper> "1906"^^xsd:int
+	] ;
+	<isPublishedInSeries> [
+		<hasNumber> "12"^^xsd:int ;
+		<inSeries> [
+			a <PublisherSeries> ;
+			<hasName> "Tuttle Classics"
+		]
+	] ;
+	<hasCharacter> "Mr. Sneaze" ;
+	<hasCharacter> "Waverhouse" ;
+	<hasPlace> [
+		a <Place> ;
+		<hasName> "Tokyo, Japan"
+	] ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> [
+			a <Person> ;
+			<hasName> "Soseki Natsume"
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceLibraryThing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+// testLibraryThingWork returns a LibraryThing work by Knut Hamsun with the
+// given title, first published in 1890, in a series.
+func testLibraryThingWork(title string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<response stat="ok">
+  <ltml xmlns="http://www.librarything.com/" version="1.1">
+    <item id="1" type="work">
+      <author id="1" authorcode="hamsunknut">Knut Hamsun</author>
+      <title>` + title + `</title>
+      <commonknowledge>
+        <fieldList>
+          <field type="16" name="originalpublicationdate" displayName="Original publication date">
+            <versionList>
+              <version id="1" archived="0" lang="eng">
+                <factList>
+                  <fact>1890</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+          <field type="42" name="series" displayName="Series">
+            <versionList>
+              <version id="2" archived="0" lang="eng">
+                <factList>
+                  <fact>Samlede verker (1)</fact>
+                </factList>
+              </version>
+            </versionList>
+          </field>
+        </fieldList>
+      </commonknowledge>
+    </item>
+  </ltml>
+</response>`
+}
+
+func TestIngestLibraryThingEndpoint(t *testing.T) {
+	m := &metadataService{
+		triplestore: mustDecode(`
+<person/1> a <Person> ;
+	<hasName> "Knut Hamsun" .
+<work/1> a <Work> ;
+	<hasName> "Sult" ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> <person/1>
+	] .`),
+		searchService: newTestSearchService(),
+		indexingQueue: make(chan rdf.NamedNode),
+	}
+	go m.processIndexingQueue()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	// A Work which is not found is not created.
+	testWantStatus(t, "POST", srv.URL+"/ingest?source=librarything", testLibraryThingWork("Pan"), http.StatusNotFound)
+
+	ingest := func() ingestReport {
+		resp, err := http.Post(srv.URL+"/ingest?source=librarything", "application/xml",
+			strings.NewReader(testLibraryThingWork("Sult")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("got %v; want %v", resp.Status, http.StatusCreated)
+		}
+		if loc := resp.Header.Get("Location"); loc != "/resource/work/1" {
+			t.Errorf("got Location %q; want /resource/work/1", loc)
+		}
+		var rep ingestReport
+		if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+			t.Fatal(err)
+		}
+		return rep
+	}
+
+	rep := ingest()
+	if rep.Work != "work/1" || rep.Publication != "" {
+		t.Errorf("got work %q and publication %q; want work/1 and no publication", rep.Work, rep.Publication)
+	}
+	for _, r := range rep.Created {
+		if r.Type != "PublisherSeries" {
+			t.Errorf("got created %+v; want only the series", r)
+		}
+	}
+
+	// Ingesting the work again replaces the facts.
+	ingest()
+
+	publications, err := selectNodes(m.triplestore, rdf.NewVariable("p"),
+		rdf.TriplePattern{rdf.NewVariable("p"), rdf.RDFtype, rdf.NewNamedNode("Publication")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(publications) != 0 {
+		t.Errorf("got publications %v; want none", publications)
+	}
+	years, err := selectNodes(m.triplestore, rdf.NewVariable("y"),
+		rdf.TriplePattern{rdf.NewNamedNode("work/1"), rdf.NewNamedNode("hasFirstPublicationDate"), rdf.NewVariable("d")},
+		rdf.TriplePattern{rdf.NewVariable("d"), rdf.NewNamedNode("hasYear"), rdf.NewVariable("y")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(years) != 1 || years[0] != rdf.NewTypedLiteral("1890", rdf.XSDint) {
+		t.Errorf("got first publication years %v of work/1; want 1890", years)
+	}
+	series, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+		rdf.TriplePattern{rdf.NewNamedNode("work/1"), rdf.NewNamedNode("isPublishedInSeries"), rdf.NewVariable("e")},
+		rdf.TriplePattern{rdf.NewVariable("e"), rdf.NewNamedNode("inSeries"), rdf.NewVariable("s")},
+		rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode("PublisherSeries")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 {
+		t.Errorf("got series %v of work/1; want one", series)
+	}
+}
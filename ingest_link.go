@@ -0,0 +1,588 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// namedClasses are the classes of resources which are linked by name only,
+// with the path of the URIs minted for new resources.
+var namedClasses = []struct{ class, path string }{
+	{"PublisherSeries", "publisherSeries"},
+	{"Place", "place"},
+	{"Topic", "topic"},
+}
+
+// linkByName links the resources of the given class in an ingested graph to
+// the resources in the triplestore with the same name. Resources which are
+// not found are given new URIs under path, so that they are created when the
+// graph is stored. The ingested descriptions of the linked resources are
+// kept, so that they are stored with the provenance of the graph. The
+// outcome is added to the report rec.
+func (m *metadataService) linkByName(g *memory.Graph, class, path string, rec *reconciliation) (*memory.Graph, error) {
+	nodes, err := selectNodes(g, rdf.NewVariable("s"),
+		rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode(class)})
+	if err != nil {
+		return nil, err
+	}
+
+	subst := make(map[rdf.Node]rdf.Node)
+	for _, s := range nodes {
+		if _, ok := s.(rdf.BlankNode); !ok {
+			continue
+		}
+		names, err := selectNodes(g, rdf.NewVariable("name"),
+			rdf.TriplePattern{s, rdf.NewNamedNode("hasName"), rdf.NewVariable("name")})
+		if err != nil {
+			return nil, err
+		}
+		r := reconciledResource{Type: class}
+		if len(names) > 0 {
+			if lit, ok := names[0].(rdf.Literal); ok {
+				r.Name = lit.String()
+			}
+		}
+		for _, name := range names {
+			existing, err := selectNodes(m.triplestore, rdf.NewVariable("s"),
+				rdf.TriplePattern{rdf.NewVariable("s"), rdf.RDFtype, rdf.NewNamedNode(class)},
+				rdf.TriplePattern{rdf.NewVariable("s"), rdf.NewNamedNode("hasName"), name})
+			if err != nil {
+				return nil, err
+			}
+			if len(existing) == 0 {
+				continue
+			}
+			if uri, ok := existing[0].(rdf.NamedNode); ok {
+				subst[s] = uri
+				r.URI, r.MatchedBy = uri.Name(), "name"
+				break
+			}
+		}
+		if r.URI != "" {
+			rec.Matched = append(rec.Matched, r)
+		} else {
+			uri := rdf.NewNamedNode(m.ns + path + "/" + m.nextID(path))
+			subst[s] = uri
+			r.URI = uri.Name()
+			rec.Created = append(rec.Created, r)
+		}
+	}
+	if len(subst) == 0 {
+		return g, nil
+	}
+
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteGraph(trs, subst), nil
+}
+
+// reconciliation reports how the agents, works and resources linked by name
+// in an ingested graph were reconciled with the resources in the triplestore.
+type reconciliation struct {
+	Matched   []reconciledResource `json:"matched"`
+	Created   []reconciledResource `json:"created"`
+	Ambiguous []reconciledResource `json:"ambiguous"`
+}
+
+// reconciledResource is an agent, work or resource linked by name in an
+// ingested graph, and the URI it was given.
+type reconciledResource struct {
+	Type string `json:"type"`
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+
+	// MatchedBy is "authority", "name", "title" or "uniformTitle"
+	// for matched resources, or "publication" for the Work and publisher
+	// of a matched Publication.
+	MatchedBy string `json:"matchedBy,omitempty"`
+
+	// Candidates are the URIs of the existing resources an ambiguous
+	// resource matches.
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// agentClasses are the classes of agents which are reconciled, with
+// the path of the URIs minted for new agents.
+var agentClasses = []struct{ class, path string }{
+	{"Person", "person"},
+	{"Corporation", "corporation"},
+}
+
+// reconcile links the resources in an ingested graph to the existing
+// resources in the triplestore, and gives new URIs to the rest.
+func (m *metadataService) reconcile(g *memory.Graph) (*memory.Graph, *reconciliation, error) {
+	linked := &reconciliation{}
+	for _, c := range namedClasses {
+		var err error
+		if g, err = m.linkByName(g, c.class, c.path, linked); err != nil {
+			return nil, nil, err
+		}
+	}
+	g, rec, err := m.reconcileAgents(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec.Matched = append(rec.Matched, linked.Matched...)
+	rec.Created = append(rec.Created, linked.Created...)
+	g, err = m.reconcileWorks(g, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, rec, nil
+}
+
+// reconcileAgents links the agents in an ingested graph to the agents in the
+// triplestore, matching first by authority ID, then by name and dates. The
+// agents which are not found, or which match more than one existing agent,
+// are given new URIs. The ingested descriptions of the matched agents are
+// kept, like their authority IDs and dates.
+func (m *metadataService) reconcileAgents(g *memory.Graph) (*memory.Graph, *reconciliation, error) {
+	subst := make(map[rdf.Node]rdf.Node)
+
+	type pending struct {
+		agent  reconciledResource
+		report *[]reconciledResource
+	}
+	rec := &reconciliation{}
+	var agents []pending
+
+	for _, c := range agentClasses {
+		class := rdf.NewNamedNode(c.class)
+		nodes, err := selectNodes(g, rdf.NewVariable("a"),
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.RDFtype, class})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, node := range nodes {
+			if _, ok := node.(rdf.BlankNode); !ok {
+				continue
+			}
+			candidates, by, err := m.findAgent(g, node, class)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch len(candidates) {
+			case 0:
+				uri := rdf.NewNamedNode(m.ns + c.path + "/" + m.nextID(c.path))
+				subst[node] = uri
+				agents = append(agents, pending{reconciledResource{Type: c.class, URI: uri.Name()}, &rec.Created})
+			case 1:
+				subst[node] = candidates[0]
+				agents = append(agents, pending{reconciledResource{Type: c.class, URI: candidates[0].Name(), MatchedBy: by}, &rec.Matched})
+			default:
+				uri := rdf.NewNamedNode(m.ns + c.path + "/" + m.nextID(c.path))
+				subst[node] = uri
+				a := reconciledResource{Type: c.class, URI: uri.Name()}
+				for _, c := range candidates {
+					a.Candidates = append(a.Candidates, c.Name())
+				}
+				agents = append(agents, pending{a, &rec.Ambiguous})
+			}
+		}
+	}
+	if len(subst) == 0 {
+		return g, rec, nil
+	}
+
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The names of the agents are reported as given in the ingested
+	// graph, also for the matched agents.
+	res := rewriteGraph(trs, subst)
+	for _, p := range agents {
+		var named struct {
+			Name string `rdf:"->hasName"`
+		}
+		if err := res.Decode(&named, rdf.NewNamedNode(p.agent.URI), rdf.NewNamedNode(""), nil); err != nil {
+			return nil, nil, err
+		}
+		p.agent.Name = named.Name
+		*p.report = append(*p.report, p.agent)
+	}
+	return res, rec, nil
+}
+
+// findAgent returns the existing agents of the given class matching the agent
+// in the ingested graph g, and how they were matched. Agents with the same
+// authority ID are preferred. Otherwise, agents with the same name match,
+// unless they have other authority IDs or other birth or death years.
+func (m *metadataService) findAgent(g *memory.Graph, agent rdf.Node, class rdf.NamedNode) ([]rdf.NamedNode, string, error) {
+	var res []rdf.NamedNode
+	found := make(map[rdf.NamedNode]bool)
+	add := func(nodes []rdf.Node) {
+		for _, n := range nodes {
+			if uri, ok := n.(rdf.NamedNode); ok && !found[uri] {
+				found[uri] = true
+				res = append(res, uri)
+			}
+		}
+	}
+
+	ids, err := selectNodes(g, rdf.NewVariable("id"),
+		rdf.TriplePattern{agent, rdf.NewNamedNode("hasAuthorityID"), rdf.NewVariable("id")})
+	if err != nil {
+		return nil, "", err
+	}
+	for _, id := range ids {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("a"),
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.RDFtype, class},
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.NewNamedNode("hasAuthorityID"), id})
+		if err != nil {
+			return nil, "", err
+		}
+		add(nodes)
+	}
+	if len(res) > 0 {
+		return res, "authority", nil
+	}
+
+	names, err := selectNodes(g, rdf.NewVariable("name"),
+		rdf.TriplePattern{agent, rdf.NewNamedNode("hasName"), rdf.NewVariable("name")})
+	if err != nil {
+		return nil, "", err
+	}
+	for _, name := range names {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("a"),
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.RDFtype, class},
+			rdf.TriplePattern{rdf.NewVariable("a"), rdf.NewNamedNode("hasName"), name})
+		if err != nil {
+			return nil, "", err
+		}
+		var same []rdf.Node
+		for _, n := range nodes {
+			if len(ids) > 0 {
+				other, err := selectNodes(m.triplestore, rdf.NewVariable("id"),
+					rdf.TriplePattern{n, rdf.NewNamedNode("hasAuthorityID"), rdf.NewVariable("id")})
+				if err != nil {
+					return nil, "", err
+				}
+				if len(other) > 0 {
+					continue
+				}
+			}
+			ok := true
+			for _, date := range []string{"hasBirthDate", "hasDeathDate"} {
+				if ok, err = sameYear(g, agent, m.triplestore, n, date); err != nil {
+					return nil, "", err
+				} else if !ok {
+					break
+				}
+			}
+			if ok {
+				same = append(same, n)
+			}
+		}
+		add(same)
+	}
+	return res, "name", nil
+}
+
+// sameYear reports whether the node a in graph ga and node b in graph gb have
+// the same year for the given date property, or if any of them are without it.
+func sameYear(ga rdf.Graph, a rdf.Node, gb rdf.Graph, b rdf.Node, date string) (bool, error) {
+	var years [2][]rdf.Node
+	for i, n := range []struct {
+		g    rdf.Graph
+		node rdf.Node
+	}{{ga, a}, {gb, b}} {
+		nodes, err := selectNodes(n.g, rdf.NewVariable("y"),
+			rdf.TriplePattern{n.node, rdf.NewNamedNode(date), rdf.NewVariable("d")},
+			rdf.TriplePattern{rdf.NewVariable("d"), rdf.NewNamedNode("hasYear"), rdf.NewVariable("y")})
+		if err != nil {
+			return false, err
+		}
+		if len(nodes) == 0 {
+			return true, nil
+		}
+		years[i] = nodes
+	}
+	for _, y1 := range years[0] {
+		for _, y2 := range years[1] {
+			if y1 == y2 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// workTitles are the titles and language of a Work, used for clustering.
+type workTitles struct {
+	Names          []string `rdf:">>hasName"`
+	Titles         []string `rdf:">>hasTitle"`
+	OriginalTitles []string `rdf:">>hasOriginalTitle"`
+	Language       string   `rdf:"->hasLanguage"`
+}
+
+// normalized returns the set of normalized titles.
+func (t workTitles) normalized() map[string]bool {
+	res := make(map[string]bool)
+	for _, titles := range [][]string{t.Names, t.Titles, t.OriginalTitles} {
+		for _, title := range titles {
+			if title = normalizeTitle(title); title != "" {
+				res[title] = true
+			}
+		}
+	}
+	return res
+}
+
+// normalizeTitle returns the title in lower case, without punctuation.
+func normalizeTitle(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// reconcileWorks links the Works in an ingested graph, where the agents
+// are already reconciled, to the existing Works in the triplestore, so that
+// publications of the same Work are clustered. A Work matches an existing
+// Work by the same author (or a translation of the same original Work) with
+// the same normalized title or original title, and in the same language.
+// Works without authors match by their uniform title. The Works which are
+// not found, or which match more than one existing Work, are given new URIs.
+// The ingested descriptions of the matched Works are kept. The outcome is
+// added to the report rec.
+func (m *metadataService) reconcileWorks(g *memory.Graph, rec *reconciliation) (*memory.Graph, error) {
+	nodes, err := selectNodes(g, rdf.NewVariable("w"),
+		rdf.TriplePattern{rdf.NewVariable("w"), rdf.RDFtype, rdf.NewNamedNode("Work")})
+	if err != nil {
+		return nil, err
+	}
+
+	// Give the works URIs, so that we can query and decode them.
+	subst := make(map[rdf.Node]rdf.Node)
+	works := make(map[rdf.NamedNode]rdf.Node)
+	for _, node := range nodes {
+		if _, ok := node.(rdf.BlankNode); ok {
+			uri := rdf.NewNamedNode(m.ns + "work/" + m.nextID("work"))
+			subst[node] = uri
+			works[uri] = node
+		}
+	}
+	if len(subst) == 0 {
+		return g, nil
+	}
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, err
+	}
+	full := rewriteGraph(trs, subst)
+
+	// Works which are not translations are reconciled first, so that the
+	// translations can be matched to translations of the same original.
+	var originals, translations []rdf.NamedNode
+	translationOf := make(map[rdf.NamedNode]rdf.NamedNode)
+	for uri := range works {
+		orig, err := selectNodes(full, rdf.NewVariable("o"),
+			rdf.TriplePattern{uri, rdf.NewNamedNode("isTranslationOf"), rdf.NewVariable("o")})
+		if err != nil {
+			return nil, err
+		}
+		if len(orig) > 0 {
+			if o, ok := orig[0].(rdf.NamedNode); ok {
+				translationOf[uri] = o
+				translations = append(translations, uri)
+				continue
+			}
+		}
+		originals = append(originals, uri)
+	}
+
+	for _, uri := range append(originals, translations...) {
+		var titles workTitles
+		if err := full.Decode(&titles, uri, rdf.NewNamedNode(""), nil); err != nil {
+			return nil, err
+		}
+		var name string
+		if len(titles.Names) > 0 {
+			name = titles.Names[0]
+		}
+
+		var orig rdf.Node
+		if o, ok := translationOf[uri]; ok {
+			// The original is either matched to an existing Work, or new.
+			orig = subst[works[o]]
+		}
+		candidates, by, err := m.findWork(full, uri, titles, orig)
+		if err != nil {
+			return nil, err
+		}
+		node := works[uri]
+		switch len(candidates) {
+		case 0:
+			rec.Created = append(rec.Created, reconciledResource{Type: "Work", URI: uri.Name(), Name: name})
+		case 1:
+			subst[node] = candidates[0]
+			rec.Matched = append(rec.Matched, reconciledResource{Type: "Work", URI: candidates[0].Name(), Name: name, MatchedBy: by})
+		default:
+			r := reconciledResource{Type: "Work", URI: uri.Name(), Name: name}
+			for _, c := range candidates {
+				r.Candidates = append(r.Candidates, c.Name())
+			}
+			rec.Ambiguous = append(rec.Ambiguous, r)
+		}
+	}
+
+	return rewriteGraph(trs, subst), nil
+}
+
+// linkStructures returns the graph g, where the blank nodes which the
+// existing resources in matched link to, like Contributions and Dates, are
+// replaced by the blank nodes they already link to with the same
+// description, if any. The statements about them are kept, so that they are
+// stored with the provenance of g, but the existing resources are not given
+// duplicates of them. Blank nodes which link to other blank nodes are not
+// compared.
+func (m *metadataService) linkStructures(g *memory.Graph, matched []rdf.NamedNode) (*memory.Graph, error) {
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, err
+	}
+	isMatched := make(map[rdf.Node]bool, len(matched))
+	for _, uri := range matched {
+		isMatched[uri] = true
+	}
+	desc := make(map[rdf.Node][]rdf.Triple)
+	for _, tr := range trs {
+		if _, ok := tr.Subject.(rdf.BlankNode); ok {
+			desc[tr.Subject] = append(desc[tr.Subject], tr)
+		}
+	}
+
+	n := rdf.NewVariable("n")
+	subst := make(map[rdf.Node]rdf.Node)
+	for _, tr := range trs {
+		if _, ok := tr.Object.(rdf.BlankNode); !ok || !isMatched[tr.Subject] {
+			continue
+		}
+		if _, ok := subst[tr.Object]; ok {
+			continue
+		}
+		where := []rdf.TriplePattern{{tr.Subject, tr.Predicate, n}}
+		nested := false
+		for _, d := range desc[tr.Object] {
+			if _, ok := d.Object.(rdf.BlankNode); ok {
+				nested = true
+				break
+			}
+			where = append(where, rdf.TriplePattern{n, d.Predicate, d.Object})
+		}
+		if nested {
+			continue
+		}
+		existing, err := selectNodes(m.triplestore, n, where...)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range existing {
+			if _, ok := e.(rdf.BlankNode); ok {
+				subst[tr.Object] = e
+				break
+			}
+		}
+	}
+	if len(subst) == 0 {
+		return g, nil
+	}
+	return rewriteGraph(trs, subst), nil
+}
+
+// findWork returns the existing Works matching the Work uri in the ingested
+// graph g, which is a translation of orig, if not nil. It also returns how
+// the Works were matched. See reconcileWorks.
+func (m *metadataService) findWork(g *memory.Graph, uri rdf.NamedNode, titles workTitles, orig rdf.Node) ([]rdf.NamedNode, string, error) {
+	var candidates []rdf.Node
+	if orig != nil {
+		res, err := selectNodes(m.triplestore, rdf.NewVariable("w"),
+			rdf.TriplePattern{rdf.NewVariable("w"), rdf.NewNamedNode("isTranslationOf"), orig})
+		if err != nil {
+			return nil, "", err
+		}
+		candidates = res
+	} else {
+		authors, err := selectNodes(g, rdf.NewVariable("a"),
+			rdf.TriplePattern{uri, rdf.NewNamedNode("hasContribution"), rdf.NewVariable("c")},
+			rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+			rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasAgent"), rdf.NewVariable("a")})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(authors) == 0 {
+			return m.findWorkByUniformTitle(g, uri)
+		}
+		for _, a := range authors {
+			res, err := selectNodes(m.triplestore, rdf.NewVariable("w"),
+				rdf.TriplePattern{rdf.NewVariable("w"), rdf.RDFtype, rdf.NewNamedNode("Work")},
+				rdf.TriplePattern{rdf.NewVariable("w"), rdf.NewNamedNode("hasContribution"), rdf.NewVariable("c")},
+				rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+				rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasAgent"), a})
+			if err != nil {
+				return nil, "", err
+			}
+			candidates = append(candidates, res...)
+		}
+	}
+
+	want := titles.normalized()
+	var res []rdf.NamedNode
+	seen := make(map[rdf.NamedNode]bool)
+	for _, c := range candidates {
+		w, ok := c.(rdf.NamedNode)
+		if !ok || seen[w] {
+			continue
+		}
+		seen[w] = true
+		desc, err := m.describe(rdf.DescSymmetricRecursive, w)
+		if err != nil {
+			return nil, "", err
+		}
+		var existing workTitles
+		if err := desc.Decode(&existing, w, rdf.NewNamedNode(""), nil); err != nil {
+			return nil, "", err
+		}
+		if titles.Language != "" && existing.Language != "" && titles.Language != existing.Language {
+			continue
+		}
+		for title := range existing.normalized() {
+			if want[title] {
+				res = append(res, w)
+				break
+			}
+		}
+	}
+	return res, "title", nil
+}
+
+// findWorkByUniformTitle returns the existing Works with the same uniform
+// title (hasOriginalTitle) as the Work uri in the ingested graph g.
+func (m *metadataService) findWorkByUniformTitle(g *memory.Graph, uri rdf.NamedNode) ([]rdf.NamedNode, string, error) {
+	uniform, err := selectNodes(g, rdf.NewVariable("t"),
+		rdf.TriplePattern{uri, rdf.NewNamedNode("hasOriginalTitle"), rdf.NewVariable("t")})
+	if err != nil {
+		return nil, "", err
+	}
+	var res []rdf.NamedNode
+	for _, t := range uniform {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("w"),
+			rdf.TriplePattern{rdf.NewVariable("w"), rdf.RDFtype, rdf.NewNamedNode("Work")},
+			rdf.TriplePattern{rdf.NewVariable("w"), rdf.NewNamedNode("hasOriginalTitle"), t})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, n := range nodes {
+			if w, ok := n.(rdf.NamedNode); ok {
+				res = append(res, w)
+			}
+		}
+	}
+	return res, "uniformTitle", nil
+}
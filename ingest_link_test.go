@@ -0,0 +1,392 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+func TestLinkByName(t *testing.T) {
+	m := &metadataService{
+		ns:          "http://test.org/",
+		triplestore: memory.NewGraph(),
+	}
+	existing := rdf.NewNamedNode("http://test.org/publisherSeries/1")
+	m.triplestore.Insert(
+		rdf.Triple{existing, rdf.RDFtype, rdf.NewNamedNode("PublisherSeries")},
+		rdf.Triple{existing, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral("Gyldendal pocket")})
+
+	rec := &reconciliation{}
+	g, err := m.linkByName(mustDecode(`
+<p> a <Publication> ;
+	<isPublishedInSeries> [
+		<hasNumber> "12"^^<http://www.w3.org/2001/XMLSchema#int> ;
+		<inSeries> [
+			a <PublisherSeries> ;
+			<hasName> "Gyldendal pocket"
+		]
+	] ;
+	<isPublishedInSeries> [
+		<inSeries> [
+			a <PublisherSeries> ;
+			<hasName> "Hamsun i utvalg"
+		]
+	] .`), "PublisherSeries", "publisherSeries", rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := selectNodes(g, rdf.NewVariable("s"),
+		rdf.TriplePattern{rdf.NewNamedNode("p"), rdf.NewNamedNode("isPublishedInSeries"), rdf.NewVariable("entry")},
+		rdf.TriplePattern{rdf.NewVariable("entry"), rdf.NewNamedNode("inSeries"), rdf.NewVariable("s")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("got %d series; want 2", len(series))
+	}
+	var linked, created int
+	for _, s := range series {
+		uri, ok := s.(rdf.NamedNode)
+		if !ok {
+			t.Errorf("series %v not given an URI", s)
+			continue
+		}
+		if uri == existing {
+			linked++
+			continue
+		}
+		created++
+		if names, _ := selectNodes(g, rdf.NewVariable("name"),
+			rdf.TriplePattern{uri, rdf.NewNamedNode("hasName"), rdf.NewVariable("name")}); len(names) != 1 {
+			t.Errorf("new series %v: got %d names; want 1", uri, len(names))
+		}
+	}
+	if linked != 1 || created != 1 {
+		t.Errorf("got %d linked and %d created series; want 1 and 1", linked, created)
+	}
+	if len(rec.Matched) != 1 || rec.Matched[0].URI != existing.Name() || rec.Matched[0].MatchedBy != "name" {
+		t.Errorf("got matched %+v; want %v matched by name", rec.Matched, existing)
+	}
+	if len(rec.Created) != 1 || rec.Created[0].Name != "Hamsun i utvalg" {
+		t.Errorf("got created %+v; want Hamsun i utvalg", rec.Created)
+	}
+
+	// The ingested description of the existing series is kept.
+	if names, _ := selectNodes(g, rdf.NewVariable("name"),
+		rdf.TriplePattern{existing, rdf.NewNamedNode("hasName"), rdf.NewVariable("name")}); len(names) != 1 {
+		t.Errorf("got %d names on existing series; want 1", len(names))
+	}
+}
+
+func TestReconcileAgents(t *testing.T) {
+	m := &metadataService{
+		ns: "http://test.org/",
+		triplestore: mustDecode(`
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<http://test.org/person/1> a <Person> ;
+	<hasName> "Knut Hamsun" ;
+	<hasAuthorityID> "(NO-TrBIB)90053126" .
+<http://test.org/person/2> a <Person> ;
+	<hasName> "Henrik Ibsen" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1828"^^xsd:int ] .
+<http://test.org/person/3> a <Person> ;
+	<hasName> "Henrik Ibsen" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1940"^^xsd:int ] .
+<http://test.org/person/4> a <Person> ;
+	<hasName> "Ola Nordmann" .
+<http://test.org/person/5> a <Person> ;
+	<hasName> "Ola Nordmann" .`),
+	}
+
+	g, rec, err := m.reconcileAgents(mustDecode(`
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Hamsun, Knut" ;
+				<hasAuthorityID> "(NO-TrBIB)90053126"
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Henrik Ibsen" ;
+				<hasBirthDate> [ a <Date> ; <hasYear> "1828"^^xsd:int ]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Ola Nordmann"
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Kari Nordmann"
+			]
+		]
+	] .`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched := make(map[string]reconciledResource)
+	for _, a := range rec.Matched {
+		matched[a.Name] = a
+	}
+	if a := matched["Hamsun, Knut"]; a.URI != "http://test.org/person/1" || a.MatchedBy != "authority" {
+		t.Errorf("got %+v; want Hamsun matched by authority to person/1", a)
+	}
+	if a := matched["Henrik Ibsen"]; a.URI != "http://test.org/person/2" || a.MatchedBy != "name" {
+		t.Errorf("got %+v; want Ibsen matched by name to person/2", a)
+	}
+	if len(rec.Ambiguous) != 1 || rec.Ambiguous[0].Name != "Ola Nordmann" || len(rec.Ambiguous[0].Candidates) != 2 {
+		t.Errorf("got ambiguous %+v; want Ola Nordmann with 2 candidates", rec.Ambiguous)
+	}
+	if len(rec.Created) != 1 || rec.Created[0].Name != "Kari Nordmann" {
+		t.Errorf("got created %+v; want Kari Nordmann", rec.Created)
+	}
+
+	agents, err := selectNodes(g, rdf.NewVariable("a"),
+		rdf.TriplePattern{rdf.NewVariable("c"), rdf.NewNamedNode("hasAgent"), rdf.NewVariable("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 4 {
+		t.Fatalf("got %d agents; want 4", len(agents))
+	}
+	for _, a := range agents {
+		if _, ok := a.(rdf.NamedNode); !ok {
+			t.Errorf("agent %v not given an URI", a)
+		}
+	}
+
+	// The ingested descriptions of the matched agents are kept.
+	if names, _ := selectNodes(g, rdf.NewVariable("name"),
+		rdf.TriplePattern{rdf.NewNamedNode("http://test.org/person/1"), rdf.NewNamedNode("hasName"), rdf.NewVariable("name")}); len(names) != 1 {
+		t.Errorf("got %d names on matched agent; want 1", len(names))
+	}
+}
+
+func TestReconcileWorks(t *testing.T) {
+	m := &metadataService{
+		ns: "http://test.org/",
+		triplestore: mustDecode(`
+<http://test.org/work/1> a <Work> ;
+	<hasName> "Sult"@nob ;
+	<hasLanguage> <lang/nob> ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> <http://test.org/person/1>
+	] .
+<http://test.org/work/2> a <Work> ;
+	<hasName> "Hunger"@eng ;
+	<hasLanguage> <lang/eng> ;
+	<isTranslationOf> <http://test.org/work/1> .
+<http://test.org/work/3> a <Work> ;
+	<hasName> "Den eldre Edda"@nob ;
+	<hasOriginalTitle> "Edda" .`),
+	}
+
+	tests := []struct {
+		input     string
+		want      string // URI of work, or empty if new
+		matchedBy string
+	}{
+		{
+			// Translation of a known original
+			`<p> a <Publication> ;
+				<isPublicationOf> [
+					a <Work> ;
+					<hasName> "Hunger."@eng ;
+					<hasLanguage> <lang/eng> ;
+					<isTranslationOf> [
+						a <Work> ;
+						<hasName> "SULT" ;
+						<hasContribution> [
+							a <Contribution> ;
+							<hasRole> <role/author> ;
+							<hasAgent> <http://test.org/person/1>
+						]
+					]
+				] .`,
+			"http://test.org/work/2",
+			"title",
+		},
+		{
+			// Work without author, with uniform title
+			`<p> a <Publication> ;
+				<isPublicationOf> [
+					a <Work> ;
+					<hasName> "Edda-dikt"@nob ;
+					<hasOriginalTitle> "Edda"
+				] .`,
+			"http://test.org/work/3",
+			"uniformTitle",
+		},
+		{
+			// Another work by the same author
+			`<p> a <Publication> ;
+				<isPublicationOf> [
+					a <Work> ;
+					<hasName> "Markens grøde"@nob ;
+					<hasContribution> [
+						a <Contribution> ;
+						<hasRole> <role/author> ;
+						<hasAgent> <http://test.org/person/1>
+					]
+				] .`,
+			"",
+			"",
+		},
+	}
+
+	for i, test := range tests {
+		rec := &reconciliation{}
+		g, err := m.reconcileWorks(mustDecode(test.input), rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		works, err := selectNodes(g, rdf.NewVariable("w"),
+			rdf.TriplePattern{rdf.NewNamedNode("p"), rdf.NewNamedNode("isPublicationOf"), rdf.NewVariable("w")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(works) != 1 {
+			t.Fatalf("%d: got %d works; want 1", i, len(works))
+		}
+		uri, ok := works[0].(rdf.NamedNode)
+		if !ok {
+			t.Errorf("%d: work %v not given an URI", i, works[0])
+			continue
+		}
+
+		if test.want == "" {
+			if len(rec.Matched) != 0 || len(rec.Created) != 1 || rec.Created[0].URI != uri.Name() {
+				t.Errorf("%d: got %+v; want new work %v", i, rec, uri)
+			}
+			continue
+		}
+		if uri.Name() != test.want {
+			t.Errorf("%d: got work %v; want %v", i, uri, test.want)
+		}
+		if len(rec.Created) != 0 {
+			t.Errorf("%d: got created %+v; want none", i, rec.Created)
+		}
+		for _, r := range rec.Matched {
+			if r.MatchedBy != test.matchedBy {
+				t.Errorf("%d: got %+v; want matched by %s", i, r, test.matchedBy)
+			}
+		}
+
+		// The ingested description of the matched work is kept.
+		if names, _ := selectNodes(g, rdf.NewVariable("name"),
+			rdf.TriplePattern{uri, rdf.NewNamedNode("hasName"), rdf.NewVariable("name")}); len(names) != 1 {
+			t.Errorf("%d: got names %v of matched work; want the ingested one", i, names)
+		}
+	}
+}
+
+func TestLinkStructures(t *testing.T) {
+	m := &metadataService{
+		ns: "http://test.org/",
+		triplestore: mustDecode(`
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<http://test.org/work/1> a <Work> ;
+	<hasName> "Sult"@nob ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> <http://test.org/person/1>
+	] .
+<http://test.org/person/1> a <Person> ;
+	<hasName> "Knut Hamsun" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1859"^^xsd:int ] .`),
+	}
+
+	// The blank nodes are given unique labels, like in prepareIngested.
+	trs, err := graphTriples(mustDecode(`
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<http://test.org/work/1> a <Work> ;
+	<hasName> "Sult"@nob ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> <http://test.org/person/1>
+	] ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/illustrator> ;
+		<hasAgent> <http://test.org/person/2>
+	] .
+<http://test.org/person/1> a <Person> ;
+	<hasName> "Knut Hamsun" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1859"^^xsd:int ] ;
+	<hasDeathDate> [ a <Date> ; <hasYear> "1952"^^xsd:int ] .`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := m.linkStructures(rewriteGraph(m.relabelBlankNodes(trs), nil),
+		[]rdf.NamedNode{rdf.NewNamedNode("http://test.org/work/1"), rdf.NewNamedNode("http://test.org/person/1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The authorship and birth date the resources already have are linked
+	// to the existing nodes, while the new ones are kept.
+	for _, test := range []struct {
+		subj, pred string
+		existing   bool
+	}{
+		{"http://test.org/work/1", "hasContribution", true},
+		{"http://test.org/person/1", "hasBirthDate", true},
+		{"http://test.org/person/1", "hasDeathDate", false},
+	} {
+		subj, pred := rdf.NewNamedNode(test.subj), rdf.NewNamedNode(test.pred)
+		existing, err := selectNodes(m.triplestore, rdf.NewVariable("o"), rdf.TriplePattern{subj, pred, rdf.NewVariable("o")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked, err := selectNodes(g, rdf.NewVariable("o"), rdf.TriplePattern{subj, pred, rdf.NewVariable("o")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := 0
+		for _, n := range linked {
+			for _, e := range existing {
+				if n == e {
+					found++
+				}
+			}
+		}
+		if test.existing && found != 1 {
+			t.Errorf("%s %s: got %v; want the existing %v linked", test.subj, test.pred, linked, existing)
+		}
+		if !test.existing && (found != 0 || len(linked) != 1) {
+			t.Errorf("%s %s: got %v; want a new node", test.subj, test.pred, linked)
+		}
+	}
+	contribs, err := selectNodes(g, rdf.NewVariable("c"),
+		rdf.TriplePattern{rdf.NewNamedNode("http://test.org/work/1"), rdf.NewNamedNode("hasContribution"), rdf.NewVariable("c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contribs) != 2 {
+		t.Errorf("got contributions %v; want the existing authorship and the new illustration", contribs)
+	}
+}
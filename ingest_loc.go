@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// modsRecord represents the parts we use of a MODS record
+// (http://www.loc.gov/standards/mods/).
+type modsRecord struct {
+	TitleInfo []struct {
+		Type     string `xml:"type,attr"`
+		NonSort  string `xml:"nonSort"`
+		Title    string `xml:"title"`
+		SubTitle string `xml:"subTitle"`
+	} `xml:"titleInfo"`
+	Name       []modsName `xml:"name"`
+	OriginInfo []struct {
+		Publisher  []string `xml:"publisher"`
+		DateIssued []struct {
+			Encoding string `xml:"encoding,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"dateIssued"`
+	} `xml:"originInfo"`
+	Language []struct {
+		Term []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"languageTerm"`
+	} `xml:"language"`
+	Extent     []string `xml:"physicalDescription>extent"`
+	Identifier []struct {
+		Type    string `xml:"type,attr"`
+		Invalid string `xml:"invalid,attr"`
+		Value   string `xml:",chardata"`
+	} `xml:"identifier"`
+	Abstract []string `xml:"abstract"`
+	Subject  []struct {
+		Topic      []string   `xml:"topic"`
+		Geographic []string   `xml:"geographic"`
+		Name       []modsName `xml:"name"`
+	} `xml:"subject"`
+}
+
+type modsName struct {
+	Type     string `xml:"type,attr"`
+	Usage    string `xml:"usage,attr"`
+	NamePart []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"namePart"`
+	Role []struct {
+		Term []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"roleTerm"`
+	} `xml:"role"`
+}
+
+// name returns the name and dates of the agent. The name is inverted,
+// like "Family, Given", when the name parts are typed, regardless of the
+// order of the parts in the record.
+func (n modsName) name() (name, dates string) {
+	var parts, family, given []string
+	for _, p := range n.NamePart {
+		switch p.Type {
+		case "date":
+			dates = p.Value
+		case "family":
+			family = append(family, trimISBD(p.Value))
+		case "given":
+			given = append(given, trimISBD(p.Value))
+		case "":
+			parts = append(parts, trimISBD(p.Value))
+		}
+	}
+	if len(family) > 0 || len(given) > 0 {
+		parts = nil
+		if len(family) > 0 {
+			parts = append(parts, strings.Join(family, " "))
+		}
+		if len(given) > 0 {
+			parts = append(parts, strings.Join(given, " "))
+		}
+	}
+	return strings.Join(parts, ", "), dates
+}
+
+// corporateName returns the name of a corporate agent, with the names
+// of any subordinate units separated by ". ".
+func (n modsName) corporateName() string {
+	var parts []string
+	for _, p := range n.NamePart {
+		if p.Type == "" {
+			parts = append(parts, trimISBD(p.Value))
+		}
+	}
+	return strings.Join(parts, ". ")
+}
+
+// role returns the role of the agent, or an empty string if there is
+// no known role.
+func (n modsName) role() string {
+	for _, r := range n.Role {
+		for _, t := range r.Term {
+			if t.Type == "code" {
+				if role, ok := relatorCodes[strings.TrimSpace(t.Value)]; ok {
+					return role
+				}
+			} else if role, ok := relatorTerms[strings.ToLower(trimISBD(t.Value))]; ok {
+				return role
+			}
+		}
+	}
+	return ""
+}
+
+// ingestLibraryOfCongress ingests a record from Library of Congress, either
+// in MODS or MARC (MARCXML, MARC-in-JSON or ISO 2709). Records can be
+// standalone or wrapped in a collection or SRU response.
+func ingestLibraryOfCongress(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	r := bufio.NewReader(input)
+	if _, err := skipSpace(r); err != nil {
+		return nil, err
+	}
+	head, _ := r.Peek(1024)
+	if bytes.Contains(head, []byte("<mods")) || bytes.Contains(head, []byte(":mods")) {
+		return ingestMODS(id, r)
+	}
+	dec, err := newMARCDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return ingestMARC(id, rec), nil
+}
+
+func ingestMODS(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	dec := xml.NewDecoder(input)
+	var rec modsRecord
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, errors.New("ingestMODS: no mods record found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "mods" {
+			if err := dec.DecodeElement(&rec, &el); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	g := memory.NewGraph()
+
+	// Publication class
+	g.Insert(rdf.Triple{id, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+
+	// Publication ISBNs
+	for _, ident := range rec.Identifier {
+		if ident.Type != "isbn" {
+			continue
+		}
+		if ident.Invalid != "" {
+			insertInvalidISBN(g, id, ident.Value)
+		} else {
+			insertISBN(g, id, ident.Value)
+		}
+	}
+
+	// Publication number of pages
+	for _, extent := range rec.Extent {
+		if numPages := cleanNumber(extent); numPages != "" {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasNumPages"), rdf.NewTypedLiteral(numPages, rdf.XSDint)})
+		}
+		break
+	}
+
+	// Publication publisher and publish-year. We prefer the machine
+	// readable date if present.
+	for _, origin := range rec.OriginInfo {
+		var year string
+		for _, d := range origin.DateIssued {
+			if y := cleanNumber(d.Value); y != "" && (year == "" || d.Encoding != "") {
+				year = y
+			}
+		}
+		if year != "" {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+		}
+		for _, p := range origin.Publisher {
+			bNode := rdf.NewBlankNode("publisher")
+			g.Insert(
+				rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode},
+				rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+				rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(trimISBD(p))})
+			break
+		}
+		break
+	}
+
+	// Publication description, with each abstract as an escaped
+	// paragraph, like the MARC 520 summary.
+	var summary []string
+	for _, s := range rec.Abstract {
+		if s = strings.TrimSpace(s); s != "" {
+			summary = append(summary, "<p>"+html.EscapeString(s)+"</p>")
+		}
+	}
+	if len(summary) > 0 {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublisherDescription"), rdf.NewStrLiteral(strings.Join(summary, "\n"))})
+	}
+
+	var lang string
+	for _, l := range rec.Language {
+		for _, t := range l.Term {
+			if t.Type == "code" {
+				lang = strings.TrimSpace(t.Value)
+				break
+			}
+		}
+		break
+	}
+
+	work := rdf.NewBlankNode("work")
+	g.Insert(
+		rdf.Triple{id, rdf.NewNamedNode("isPublicationOf"), work},
+		rdf.Triple{work, rdf.RDFtype, rdf.NewNamedNode("Work")})
+
+	// Publication titles and Work uniform title
+	var title, uniform string
+	for _, t := range rec.TitleInfo {
+		switch t.Type {
+		case "":
+			if title != "" {
+				continue
+			}
+			title = strings.TrimSpace(t.NonSort + t.Title)
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasMainTitle"), rdf.NewStrLiteral(title)})
+			if t.SubTitle != "" {
+				g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasSubtitle"), rdf.NewStrLiteral(t.SubTitle)})
+			}
+		case "uniform":
+			uniform = trimISBD(t.Title)
+		}
+	}
+	if title != "" {
+		if lang != "" {
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewLangLiteral(title, lang)},
+				rdf.Triple{work, rdf.NewNamedNode("hasLanguage"), rdf.NewNamedNode("lang/" + lang)})
+		} else {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(title)})
+		}
+	}
+	if uniform != "" {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasOriginalTitle"), rdf.NewStrLiteral(uniform)})
+	}
+
+	// Work contributions
+	for i, n := range rec.Name {
+		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
+		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
+		switch n.Type {
+		case "", "personal":
+			name, dates := n.name()
+			if name == "" {
+				continue
+			}
+			g.Insert(
+				rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
+				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(reinvertName(name))})
+			if dates != "" {
+				insertLifespan(g, agent, "agent"+strconv.Itoa(i), dates)
+			}
+		case "corporate":
+			name := n.corporateName()
+			if name == "" {
+				continue
+			}
+			g.Insert(
+				rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+				rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(name)})
+		default:
+			continue
+		}
+		role := n.role()
+		if role == "" && n.Usage == "primary" {
+			role = "role/author"
+		}
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent})
+		if role != "" {
+			g.Insert(rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode(role)})
+		}
+	}
+
+	// Work subjects
+	for i, s := range rec.Subject {
+		if len(s.Topic) > 0 {
+			subj := rdf.NewBlankNode("topic" + strconv.Itoa(i))
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj},
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Topic")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(strings.Join(s.Topic, " -- "))})
+		}
+		for j, place := range s.Geographic {
+			subj := rdf.NewBlankNode("place" + strconv.Itoa(i) + "_" + strconv.Itoa(j))
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj},
+				rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Place")},
+				rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(place)})
+		}
+		for j, n := range s.Name {
+			if name, _ := n.name(); name != "" && (n.Type == "" || n.Type == "personal") {
+				subj := rdf.NewBlankNode("subjectPerson" + strconv.Itoa(i) + "_" + strconv.Itoa(j))
+				g.Insert(
+					rdf.Triple{work, rdf.NewNamedNode("hasSubject"), subj},
+					rdf.Triple{subj, rdf.RDFtype, rdf.NewNamedNode("Person")},
+					rdf.Triple{subj, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(reinvertName(name))})
+			}
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestIngestLibraryOfCongressMARCXML(t *testing.T) {
+	const input = `<?xml version="1.0" encoding="UTF-8"?>
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>01031cam a22002891  4500</leader>
+  <controlfield tag="001">1617318</controlfield>
+  <controlfield tag="008">720315s1972    vtu           000 1 eng  </controlfield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">0804810346</subfield>
+  </datafield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Natsume, Sōseki,</subfield>
+    <subfield code="d">1867-1916.</subfield>
+    <subfield code="e">author.</subfield>
+  </datafield>
+  <datafield tag="240" ind1="1" ind2="0">
+    <subfield code="a">Wagahai wa neko de aru.</subfield>
+    <subfield code="l">English</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">I am a cat</subfield>
+  </datafield>
+  <datafield tag="650" ind1=" " ind2="0">
+    <subfield code="a">Cats</subfield>
+    <subfield code="v">Fiction.</subfield>
+  </datafield>
+  <datafield tag="651" ind1=" " ind2="0">
+    <subfield code="a">Japan</subfield>
+    <subfield code="v">Fiction.</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Itō, Aiko.</subfield>
+    <subfield code="4">trl</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+<p> a <Publication> ;
+	<hasISBN> "0804810346" ;
+	<hasISBN> "9780804810340" ;
+	<hasMainTitle> "I am a cat" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "I am a cat"@eng ;
+		<hasLanguage> <lang/eng> ;
+		<hasLiteraryForm> <form/fiction> ;
+		<hasSubject> [
+			a <Topic> ;
+			<hasName> "Cats -- Fiction"
+		] ;
+		<hasSubject> [
+			a <Place> ;
+			<hasName> "Japan -- Fiction"
+		] ;
+		<isTranslationOf> [
+			a <Work> ;
+			<hasName> "Wagahai wa neko de aru" ;
+			<hasContribution> [
+				a <Contribution> ;
+				<hasRole> <role/author> ;
+				<hasAgent> [
+					a <Person> ;
+					<hasName> "Sōseki Natsume" ;
+					<hasBirthDate> [
+						a <Date> ;
+						<hasYear> "1867"^^<http://www.w3.org/2001/XMLSchema#int>
+					] ;
+					<hasDeathDate> [
+						a <Date> ;
+						<hasYear> "1916"^^<http://www.w3.org/2001/XMLSchema#int>
+					]
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/translator> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Aiko Itō"
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceLibraryOfCongress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestLibraryOfCongressMODS(t *testing.T) {
+	const input = `<?xml version="1.0" encoding="UTF-8"?>
+<mods xmlns="http://www.loc.gov/mods/v3" version="3.5">
+  <titleInfo>
+    <title>I am a cat</title>
+    <subTitle>a novel</subTitle>
+  </titleInfo>
+  <titleInfo type="uniform">
+    <title>Wagahai wa neko de aru.</title>
+  </titleInfo>
+  <name type="personal" usage="primary">
+    <namePart>Natsume, Sōseki,</namePart>
+    <namePart type="date">1867-1916</namePart>
+    <role>
+      <roleTerm type="text">author.</roleTerm>
+    </role>
+  </name>
+  <name type="personal">
+    <namePart>Itō, Aiko</namePart>
+    <role>
+      <roleTerm type="code">trl</roleTerm>
+    </role>
+  </name>
+  <originInfo>
+    <publisher>Tuttle</publisher>
+    <dateIssued>[1972]</dateIssued>
+    <dateIssued encoding="marc">1972</dateIssued>
+  </originInfo>
+  <language>
+    <languageTerm authority="iso639-2b" type="code">eng</languageTerm>
+  </language>
+  <physicalDescription>
+    <extent>431 p. ; 19 cm.</extent>
+  </physicalDescription>
+  <abstract>A cat observes the follies of its human household.</abstract>
+  <abstract>&lt;script&gt;alert(1)&lt;/script&gt;</abstract>
+  <subject authority="lcsh">
+    <topic>Cats</topic>
+    <topic>Fiction</topic>
+  </subject>
+  <subject authority="lcsh">
+    <geographic>Japan</geographic>
+  </subject>
+  <identifier type="isbn">0804810346 (pbk.)</identifier>
+</mods>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasISBN> "0804810346" ;
+	<hasISBN> "9780804810340" ;
+	<hasMainTitle> "I am a cat" ;
+	<hasSubtitle> "a novel" ;
+	<hasPublishYear> "1972"^^xsd:int ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Tuttle"
+	] ;
+	<hasNumPages> "431"^^xsd:int ;
+	<hasPublisherDescription> "<p>A cat observes the follies of its human household.</p>\n<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "I am a cat"@eng ;
+		<hasLanguage> <lang/eng> ;
+		<hasOriginalTitle> "Wagahai wa neko de aru" ;
+		<hasSubject> [
+			a <Topic> ;
+			<hasName> "Cats -- Fiction"
+		] ;
+		<hasSubject> [
+			a <Place> ;
+			<hasName> "Japan"
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Sōseki Natsume" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1867"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1916"^^xsd:int
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/translator> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Aiko Itō"
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceLibraryOfCongress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestModsName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`<name><namePart>Natsume, Sōseki,</namePart><namePart type="date">1867-1916</namePart></name>`, "Natsume, Sōseki"},
+		{`<name><namePart type="family">Natsume</namePart><namePart type="given">Sōseki</namePart></name>`, "Natsume, Sōseki"},
+		{`<name><namePart type="given">Aiko</namePart><namePart type="family">Itō</namePart></name>`, "Itō, Aiko"},
+		{`<name><namePart type="given">Ursula</namePart><namePart type="family">Le</namePart><namePart type="family">Guin</namePart></name>`, "Le Guin, Ursula"},
+	}
+	for _, test := range tests {
+		var n modsName
+		if err := xml.Unmarshal([]byte(test.input), &n); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := n.name(); got != test.want {
+			t.Errorf("name of %s => %q; want %q", test.input, got, test.want)
+		}
+	}
+}
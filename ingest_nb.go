@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// nbItem represents the parts we use of an item from the Nasjonalbiblioteket
+// catalogue API (https://api.nb.no/catalog/v1/items/{id}).
+type nbItem struct {
+	ID       string `json:"id"`
+	Metadata struct {
+		Title       string   `json:"title"`
+		Creators    []string `json:"creators"`
+		Identifiers struct {
+			ISBNs []string `json:"isbns"`
+			URN   string   `json:"urn"`
+		} `json:"identifiers"`
+		OriginInfo struct {
+			Publisher string `json:"publisher"`
+			Issued    string `json:"issued"`
+		} `json:"originInfo"`
+		Languages []struct {
+			Code string `json:"code"`
+		} `json:"languages"`
+		PhysicalDescription struct {
+			Extent string `json:"extent"`
+		} `json:"physicalDescription"`
+		Genres []string `json:"genres"`
+	} `json:"metadata"`
+}
+
+// ingestNasjonalbiblioteket ingests a record from Nasjonalbiblioteket, either
+// as MARC (from their SRU/OAI-PMH endpoints or file exports) or as a JSON
+// item from their catalogue API.
+func ingestNasjonalbiblioteket(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	r := bufio.NewReader(input)
+	b, err := skipSpace(r)
+	if err != nil {
+		return nil, err
+	}
+	if head, _ := r.Peek(512); b == '{' && !bytes.Contains(head, []byte(`"leader"`)) {
+		return ingestNasjonalbiblioteketJSON(id, r)
+	}
+	dec, err := newMARCDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return ingestMARC(id, rec), nil
+}
+
+func ingestNasjonalbiblioteketJSON(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	var item nbItem
+	if err := json.NewDecoder(input).Decode(&item); err != nil {
+		return nil, err
+	}
+	md := item.Metadata
+	if md.Title == "" {
+		return nil, errors.New("ingestNasjonalbiblioteket: item has no title")
+	}
+
+	g := memory.NewGraph()
+
+	// Publication class
+	g.Insert(rdf.Triple{id, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+
+	// Publication ISBNs
+	for _, isbn := range md.Identifiers.ISBNs {
+		insertISBN(g, id, isbn)
+	}
+
+	// Publication number of pages
+	if numPages := cleanNumber(md.PhysicalDescription.Extent); numPages != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasNumPages"), rdf.NewTypedLiteral(numPages, rdf.XSDint)})
+	}
+
+	// Publication publisher and publish-year
+	if year := cleanNumber(md.OriginInfo.Issued); year != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+	}
+	if md.OriginInfo.Publisher != "" {
+		bNode := rdf.NewBlankNode("publisher")
+		g.Insert(
+			rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode},
+			rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+			rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(md.OriginInfo.Publisher)})
+	}
+
+	var lang string
+	for _, l := range md.Languages {
+		lang = l.Code
+		break
+	}
+
+	work := rdf.NewBlankNode("work")
+	g.Insert(
+		rdf.Triple{id, rdf.NewNamedNode("isPublicationOf"), work},
+		rdf.Triple{work, rdf.RDFtype, rdf.NewNamedNode("Work")},
+		rdf.Triple{id, rdf.NewNamedNode("hasMainTitle"), rdf.NewStrLiteral(md.Title)})
+	if lang != "" {
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewLangLiteral(md.Title, lang)},
+			rdf.Triple{work, rdf.NewNamedNode("hasLanguage"), rdf.NewNamedNode("lang/" + lang)})
+	} else {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(md.Title)})
+	}
+
+	// Work contributions; the API lists creators without roles, so
+	// we treat them as authors.
+	for i, name := range md.Creators {
+		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
+		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
+			rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
+			rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(reinvertName(name))})
+	}
+
+	// Work literary form, with the genres mapped like the genre terms in MARC
+	for _, s := range md.Genres {
+		if form, ok := literaryFormTerms[strings.ToLower(trimISBD(s))]; ok {
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasLiteraryForm"), rdf.NewNamedNode(form)})
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestIngestNasjonalbiblioteketJSON(t *testing.T) {
+	// https://api.nb.no/catalog/v1/items/1ba4c9fa5e0b3c8b7d2fd0dc0d63a8f6 (trimmed)
+	const input = `{
+  "id": "1ba4c9fa5e0b3c8b7d2fd0dc0d63a8f6",
+  "metadata": {
+    "title": "Sult",
+    "creators": ["Hamsun, Knut"],
+    "identifiers": {
+      "isbns": ["8205307180"],
+      "urn": "URN:NBN:no-nb_digibok_2008071600055"
+    },
+    "originInfo": {
+      "publisher": "Gyldendal",
+      "issued": "2002"
+    },
+    "languages": [{"code": "nob"}],
+    "physicalDescription": {"extent": "219 s."},
+    "genres": ["Romaner", "Skjønnlitteratur", "Ukjent sjanger"]
+  }
+}`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasISBN> "8205307180" ;
+	<hasISBN> "9788205307186" ;
+	<hasMainTitle> "Sult" ;
+	<hasPublishYear> "2002"^^xsd:int ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Gyldendal"
+	] ;
+	<hasNumPages> "219"^^xsd:int ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<hasLiteraryForm> <form/novel> ;
+		<hasLiteraryForm> <form/fiction> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Knut Hamsun"
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceNasjonalbiblioteket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestNasjonalbiblioteketMARCXML(t *testing.T) {
+	const input = `
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>00642cam a2200217 c 4500</leader>
+  <controlfield tag="001">020124830</controlfield>
+  <controlfield tag="008">020404s2002    no#|||||||||||000|1|nob|d</controlfield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">8205307180</subfield>
+  </datafield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Hamsun, Knut</subfield>
+    <subfield code="d">1859-1952</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+  <datafield tag="260" ind1=" " ind2=" ">
+    <subfield code="a">Oslo</subfield>
+    <subfield code="b">Gyldendal</subfield>
+    <subfield code="c">2002</subfield>
+  </datafield>
+  <datafield tag="300" ind1=" " ind2=" ">
+    <subfield code="a">219 s.</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasISBN> "8205307180" ;
+	<hasISBN> "9788205307186" ;
+	<hasMainTitle> "Sult" ;
+	<hasPublishYear> "2002"^^xsd:int ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Gyldendal"
+	] ;
+	<hasPubliationPlace> [
+		a <Place> ;
+		<hasName> "Oslo"
+	] ;
+	<hasNumPages> "219"^^xsd:int ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<hasLiteraryForm> <form/fiction> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Knut Hamsun" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1859"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1952"^^xsd:int
+				]
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceNasjonalbiblioteket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// olKey is a reference to another Open Library document.
+type olKey struct {
+	Key string `json:"key"`
+}
+
+// olText is a text value which Open Library serializes either as a
+// plain string, or as an object with a type and value.
+type olText string
+
+func (t *olText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = olText(s)
+		return nil
+	}
+	var v struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = olText(v.Value)
+	return nil
+}
+
+// olDoc represents the parts we use of an Open Library edition, work
+// or author document. The kind of document is given by its key.
+type olDoc struct {
+	Key string `json:"key"`
+
+	// Edition and work
+	Title       string  `json:"title"`
+	Subtitle    string  `json:"subtitle"`
+	Description olText  `json:"description"`
+	Authors     []olKey `json:"authors"`
+	Languages   []olKey `json:"languages"`
+
+	// Edition
+	Publishers    []string `json:"publishers"`
+	PublishDate   string   `json:"publish_date"`
+	NumberOfPages int      `json:"number_of_pages"`
+	ISBN10        []string `json:"isbn_10"`
+	ISBN13        []string `json:"isbn_13"`
+	Covers        []int    `json:"covers"`
+	Works         []olKey  `json:"works"`
+
+	// Author
+	Name      string `json:"name"`
+	BirthDate string `json:"birth_date"`
+	DeathDate string `json:"death_date"`
+}
+
+func (d *olDoc) UnmarshalJSON(b []byte) error {
+	// Editions list authors as {"key": ...}, while works list them
+	// as {"author": {"key": ...}}, so we need to decode them separately.
+	type doc olDoc
+	var v struct {
+		doc
+		Authors []json.RawMessage `json:"authors"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = olDoc(v.doc)
+	for _, a := range v.Authors {
+		var ref struct {
+			olKey
+			Author olKey `json:"author"`
+		}
+		if err := json.Unmarshal(a, &ref); err != nil {
+			return err
+		}
+		if ref.Author.Key != "" {
+			d.Authors = append(d.Authors, ref.Author)
+		} else {
+			d.Authors = append(d.Authors, ref.olKey)
+		}
+	}
+	return nil
+}
+
+var reYear = regexp.MustCompile("[0-9]{3,4}")
+
+// olYear extracts the year from an Open Library date, like "9 February 1867".
+func olYear(s string) string {
+	years := reYear.FindAllString(s, -1)
+	if len(years) == 0 {
+		return ""
+	}
+	return years[len(years)-1]
+}
+
+// olLanguage returns the code of the first language of an Open Library
+// document, like "eng".
+func olLanguage(d olDoc) string {
+	for _, l := range d.Languages {
+		return strings.TrimPrefix(l.Key, "/languages/")
+	}
+	return ""
+}
+
+// ingestOpenLibrary ingests an Open Library edition, along with the work
+// and author documents it references. The input is a stream of JSON
+// documents, where the first must be the edition; the order of the rest
+// is not significant.
+func ingestOpenLibrary(id rdf.NamedNode, input io.Reader) (*memory.Graph, error) {
+	var (
+		edition olDoc
+		works   = make(map[string]olDoc)
+		authors = make(map[string]olDoc)
+	)
+	dec := json.NewDecoder(input)
+	if err := dec.Decode(&edition); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(edition.Key, "/books/") {
+		return nil, errors.New("ingestOpenLibrary: first document is not an edition: " + edition.Key)
+	}
+	for {
+		var d olDoc
+		if err := dec.Decode(&d); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(d.Key, "/works/"):
+			works[d.Key] = d
+		case strings.HasPrefix(d.Key, "/authors/"):
+			authors[d.Key] = d
+		}
+	}
+
+	g := memory.NewGraph()
+
+	// Publication class
+	g.Insert(rdf.Triple{id, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+
+	// Publication ISBNs
+	for _, isbn := range append(edition.ISBN10, edition.ISBN13...) {
+		insertISBN(g, id, isbn)
+	}
+
+	// Publication number of pages
+	if edition.NumberOfPages > 0 {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasNumPages"), rdf.NewTypedLiteral(strconv.Itoa(edition.NumberOfPages), rdf.XSDint)})
+	}
+
+	// Publication publisher and publish-year
+	if year := olYear(edition.PublishDate); year != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublishYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+	}
+	for _, p := range edition.Publishers {
+		bNode := rdf.NewBlankNode("publisher")
+		g.Insert(
+			rdf.Triple{id, rdf.NewNamedNode("hasPublisher"), bNode},
+			rdf.Triple{bNode, rdf.RDFtype, rdf.NewNamedNode("Corporation")},
+			rdf.Triple{bNode, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(p)})
+		break
+	}
+
+	// The Work is described by the first work document of the edition; an
+	// edition can in theory belong to several works, but we only model it
+	// as a publication of the first one.
+	var olWork olDoc
+	for _, ref := range edition.Works {
+		olWork = works[ref.Key]
+		break
+	}
+
+	// Publication description and cover image. Open Library usually
+	// describes the work rather than the edition, so the description of the
+	// work is used when the edition has none. The description is plain
+	// text, with a line for each paragraph; it is escaped to be shown as HTML.
+	description := edition.Description
+	if description == "" {
+		description = olWork.Description
+	}
+	var desc []string
+	for _, line := range strings.Split(string(description), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			desc = append(desc, "<p>"+html.EscapeString(line)+"</p>")
+		}
+	}
+	if len(desc) > 0 {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasPublisherDescription"), rdf.NewStrLiteral(strings.Join(desc, "\n"))})
+	}
+	for _, cover := range edition.Covers {
+		if cover > 0 {
+			g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasImage"),
+				rdf.NewNamedNode("https://covers.openlibrary.org/b/id/" + strconv.Itoa(cover) + "-L.jpg")})
+			break
+		}
+	}
+
+	// Publication title and subtitle
+	if edition.Title != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasMainTitle"), rdf.NewStrLiteral(edition.Title)})
+	}
+	if edition.Subtitle != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasSubtitle"), rdf.NewStrLiteral(edition.Subtitle)})
+	}
+
+	lang := olLanguage(edition)
+
+	// Work
+	work := rdf.NewBlankNode("work")
+	g.Insert(
+		rdf.Triple{id, rdf.NewNamedNode("isPublicationOf"), work},
+		rdf.Triple{work, rdf.RDFtype, rdf.NewNamedNode("Work")})
+
+	if title := edition.Title; title != "" {
+		if lang != "" {
+			g.Insert(
+				rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewLangLiteral(title, lang)},
+				rdf.Triple{work, rdf.NewNamedNode("hasLanguage"), rdf.NewNamedNode("lang/" + lang)})
+		} else {
+			g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(title)})
+		}
+	}
+
+	// Open Library works are titled by their original title, which we only
+	// keep when the work is in another language than the edition, since the
+	// titles otherwise mostly differ by subtitle or casing. Works usually
+	// list the authors, which editions often lack.
+	workLang := olLanguage(olWork)
+	if olWork.Title != "" && olWork.Title != edition.Title && workLang != "" && lang != "" && workLang != lang {
+		g.Insert(rdf.Triple{work, rdf.NewNamedNode("hasOriginalTitle"), rdf.NewStrLiteral(olWork.Title)})
+	}
+	workAuthors := edition.Authors
+	if len(olWork.Authors) > 0 {
+		workAuthors = olWork.Authors
+	}
+
+	// Work contributions
+	for i, ref := range workAuthors {
+		a, ok := authors[ref.Key]
+		if !ok || a.Name == "" {
+			continue
+		}
+		contrib := rdf.NewBlankNode("contrib" + strconv.Itoa(i))
+		agent := rdf.NewBlankNode("agent" + strconv.Itoa(i))
+		g.Insert(
+			rdf.Triple{work, rdf.NewNamedNode("hasContribution"), contrib},
+			rdf.Triple{contrib, rdf.RDFtype, rdf.NewNamedNode("Contribution")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasRole"), rdf.NewNamedNode("role/author")},
+			rdf.Triple{contrib, rdf.NewNamedNode("hasAgent"), agent},
+			rdf.Triple{agent, rdf.RDFtype, rdf.NewNamedNode("Person")},
+			rdf.Triple{agent, rdf.NewNamedNode("hasName"), rdf.NewStrLiteral(a.Name)})
+		if year := olYear(a.BirthDate); year != "" {
+			birthDate := rdf.NewBlankNode("agent" + strconv.Itoa(i) + "BirthDate")
+			g.Insert(
+				rdf.Triple{agent, rdf.NewNamedNode("hasBirthDate"), birthDate},
+				rdf.Triple{birthDate, rdf.RDFtype, rdf.NewNamedNode("Date")},
+				rdf.Triple{birthDate, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+		}
+		if year := olYear(a.DeathDate); year != "" {
+			deathDate := rdf.NewBlankNode("agent" + strconv.Itoa(i) + "DeathDate")
+			g.Insert(
+				rdf.Triple{agent, rdf.NewNamedNode("hasDeathDate"), deathDate},
+				rdf.Triple{deathDate, rdf.RDFtype, rdf.NewNamedNode("Date")},
+				rdf.Triple{deathDate, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(year, rdf.XSDint)})
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestIngestOpenLibrary(t *testing.T) {
+	// https://openlibrary.org/books/OL5297516M.json,
+	// https://openlibrary.org/works/OL1951370W.json and
+	// https://openlibrary.org/authors/OL213962A.json (trimmed)
+	const input = `
+{
+  "key": "/books/OL5297516M",
+  "title": "I am a cat",
+  "publishers": ["C. E. Tuttle Co"],
+  "publish_date": "1972",
+  "number_of_pages": 431,
+  "isbn_10": ["0804810346"],
+  "description": {"type": "/type/text", "value": "A cat's view of Meiji Japan.\r\n\r\n<script>alert(1)</script>"},
+  "covers": [6373427],
+  "languages": [{"key": "/languages/eng"}],
+  "works": [{"key": "/works/OL1951370W"}],
+  "authors": [{"key": "/authors/OL213962A"}]
+}
+{
+  "key": "/works/OL1951370W",
+  "title": "Wagahai wa neko de aru",
+  "languages": [{"key": "/languages/jpn"}],
+  "authors": [{"author": {"key": "/authors/OL213962A"}, "type": {"key": "/type/author_role"}}]
+}
+{
+  "key": "/authors/OL213962A",
+  "name": "Natsume Sōseki",
+  "birth_date": "9 February 1867",
+  "death_date": "9 December 1916"
+}`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasISBN> "0804810346" ;
+	<hasISBN> "9780804810340" ;
+	<hasMainTitle> "I am a cat" ;
+	<hasPublishYear> "1972"^^xsd:int ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "C. E. Tuttle Co"
+	] ;
+	<hasNumPages> "431"^^xsd:int ;
+	<hasPublisherDescription> "<p>A cat&#39;s view of Meiji Japan.</p>\n<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>" ;
+	<hasImage> <https://covers.openlibrary.org/b/id/6373427-L.jpg> ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "I am a cat"@eng ;
+		<hasLanguage> <lang/eng> ;
+		<hasOriginalTitle> "Wagahai wa neko de aru" ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Natsume Sōseki" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1867"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1916"^^xsd:int
+				]
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOpenLibrary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestOpenLibraryWork(t *testing.T) {
+	// The edition has no description, and the title of the work only
+	// differs in casing.
+	const input = `
+{
+  "key": "/books/OL5297516M",
+  "title": "I am a cat",
+  "languages": [{"key": "/languages/eng"}],
+  "works": [{"key": "/works/OL1951370W"}]
+}
+{
+  "key": "/works/OL1951370W",
+  "title": "I Am a Cat",
+  "description": "A cat's view of Meiji Japan."
+}`
+
+	const want = `
+<p> a <Publication> ;
+	<hasMainTitle> "I am a cat" ;
+	<hasPublisherDescription> "<p>A cat&#39;s view of Meiji Japan.</p>" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "I am a cat"@eng ;
+		<hasLanguage> <lang/eng>
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOpenLibrary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"sort"
 	"testing"
 
 	"github.com/knakk/kbp/rdf"
@@ -105,13 +106,22 @@ func TestIngestOriaMetadata(t *testing.T) {
 
 <p> a <Publication> ;
 	<hasISBN> "0804810346" ;
+	<hasISBN> "9780804810340" ;
 	<hasMainTitle> "I am a cat" ;
 	<hasPublishYear> "1972"^^xsd:int ;
 	<hasPublisher> [
-		a <Publisher> ;
+		a <Corporation> ;
 		<hasName> "Tuttle"
 	] ;
+	<hasPubliationPlace> [
+		a <Place> ;
+		<hasName> "Rutland, VT"
+	] ;
 	<hasBinding> <binding/hardback> ;
+	<hasISBNBinding> [
+		<hasISBN> "9780804810340" ;
+		<hasBinding> <binding/hardback>
+	] ;
 	<hasNumPages> "218"^^xsd:int ;
 	<isPublicationOf> [
 		a <Work> ;
@@ -127,6 +137,7 @@ func TestIngestOriaMetadata(t *testing.T) {
 				<hasAgent> [
 					a <Person> ;
 					<hasName> "Sôseki Natsume" ;
+					<hasAuthorityID> "(NO-TrBIB)98075025" ;
 					<hasBirthDate> [
 						a <Date> ;
 						<hasYear> "1867"^^xsd:int
@@ -142,14 +153,16 @@ func TestIngestOriaMetadata(t *testing.T) {
 			a <Contribution> ;
 			<hasAgent> [
 				a <Person> ;
-				<hasName> "Aiko Itō"
+				<hasName> "Aiko Itō" ;
+				<hasAuthorityID> "(NO-TrBIB)90764137"
 			]
 		] ;
 		<hasContribution> [
 			a <Contribution> ;
 			<hasAgent> [
 				a <Person> ;
-				<hasName> "Graeme Wilson"
+				<hasName> "Graeme Wilson" ;
+				<hasAuthorityID> "(NO-TrBIB)90764138"
 			]
 		]
 	] .
@@ -163,3 +176,791 @@ func TestIngestOriaMetadata(t *testing.T) {
 		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
 	}
 }
+
+func TestIngestOriaSerializations(t *testing.T) {
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<hasLiteraryForm> <form/fiction> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Knut Hamsun" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1859"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1952"^^xsd:int
+				]
+			]
+		]
+	] .
+	`
+
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{
+			"MARCXML",
+			`<record xmlns="http://www.loc.gov/MARC21/slim">
+			  <leader>00162cam a2200073 c 4500</leader>
+			  <controlfield tag="001">020124830</controlfield>
+			  <controlfield tag="008">020404s2002    no#|||||||||||000|1|nob|d</controlfield>
+			  <datafield tag="100" ind1="1" ind2=" ">
+			    <subfield code="a">Hamsun, Knut</subfield>
+			    <subfield code="d">1859-1952</subfield>
+			  </datafield>
+			  <datafield tag="245" ind1="1" ind2="0">
+			    <subfield code="a">Sult</subfield>
+			  </datafield>
+			</record>`,
+		},
+		{
+			"MARC-in-JSON",
+			`{
+			  "leader": "00162cam a2200073 c 4500",
+			  "fields": [
+			    {"001": "020124830"},
+			    {"008": "020404s2002    no#|||||||||||000|1|nob|d"},
+			    {"100": {"ind1": "1", "ind2": " ", "subfields": [{"a": "Hamsun, Knut"}, {"d": "1859-1952"}]}},
+			    {"245": {"ind1": "1", "ind2": "0", "subfields": [{"a": "Sult"}]}}
+			  ]
+			}`,
+		},
+		{
+			"ISO 2709",
+			"00162cam a2200073 c 4500001001000000008004100010100002800051245000900079\x1e020124830\x1e020404s2002    no#|||||||||||000|1|nob|d\x1e1 \x1faHamsun, Knut\x1fd1859-1952\x1e10\x1faSult\x1e\x1d",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(test.input), sourceOria)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if !got.Eq(mustDecode(want)) {
+			t.Errorf("%s: got:\n%v\nwant:\n%v", test.format, mustEncode(got), mustEncode(mustDecode(want)))
+		}
+	}
+}
+
+func TestIngestUnknownSource(t *testing.T) {
+	if _, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(""), source(99)); err == nil {
+		t.Error("ingestPublication with unknown source => nil error; want error")
+	}
+}
+
+func TestIngestMARCLiteraryForm(t *testing.T) {
+	tests := []struct {
+		pos33  string
+		fields string
+		want   []string
+	}{
+		{"u", ``, nil},
+		{"f", ``, []string{"form/novel"}},
+		{"j", ``, []string{"form/shortstory"}},
+		{"1", ``, []string{"form/fiction"}},
+		{
+			"1",
+			`<datafield tag="655" ind1=" " ind2="7"><subfield code="a">Dikt</subfield></datafield>`,
+			[]string{"form/poetry"},
+		},
+		{
+			"|",
+			`<datafield tag="655" ind1=" " ind2="7"><subfield code="a">Noveller</subfield></datafield>
+			 <datafield tag="655" ind1=" " ind2="7"><subfield code="a">Essays.</subfield></datafield>`,
+			[]string{"form/essay", "form/shortstory"},
+		},
+		{
+			"u",
+			`<datafield tag="653" ind1=" " ind2=" "><subfield code="a">japansk</subfield><subfield code="a">roman</subfield></datafield>`,
+			[]string{"form/novel"},
+		},
+	}
+
+	for i, test := range tests {
+		input := `<record>
+			<leader>00715cam a2200241 c 4500</leader>
+			<controlfield tag="008">150326s1972    xx#|||||||||||000|` + test.pos33 + `|eng|d</controlfield>
+			<datafield tag="245" ind1="1" ind2="0"><subfield code="a">Title</subfield></datafield>
+			` + test.fields + `
+		</record>`
+		g, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := g.Select(
+			[]rdf.Variable{rdf.NewVariable("form")},
+			rdf.TriplePattern{rdf.NewVariable("work"), rdf.NewNamedNode("hasLiteraryForm"), rdf.NewVariable("form")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, node := range res.AllBound(rdf.NewVariable("form")) {
+			got = append(got, node.(rdf.NamedNode).Name())
+		}
+		sort.Strings(got)
+		if len(got) != len(test.want) {
+			t.Errorf("%d: got forms %v; want %v", i, got, test.want)
+			continue
+		}
+		for j := range got {
+			if got[j] != test.want[j] {
+				t.Errorf("%d: got forms %v; want %v", i, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestIngestMARCSubjects(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s1996    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Hamsun, Knut</subfield>
+    <subfield code="d">1859-1952</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Brev</subfield>
+  </datafield>
+  <datafield tag="600" ind1="1" ind2="4">
+    <subfield code="a">Hamsun, Knut</subfield>
+    <subfield code="d">1859-1952</subfield>
+  </datafield>
+  <datafield tag="600" ind1="1" ind2="4">
+    <subfield code="a">Ibsen, Henrik</subfield>
+    <subfield code="d">1828-1906</subfield>
+  </datafield>
+  <datafield tag="610" ind1="2" ind2="4">
+    <subfield code="a">Gyldendal norsk forlag</subfield>
+  </datafield>
+  <datafield tag="650" ind1=" " ind2="7">
+    <subfield code="a">Forfattere</subfield>
+    <subfield code="z">Norge</subfield>
+  </datafield>
+  <datafield tag="651" ind1=" " ind2="7">
+    <subfield code="a">Nørholm</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasMainTitle> "Brev" ;
+	<isPublicationOf> _:work .
+
+_:work a <Work> ;
+	<hasName> "Brev"@nob ;
+	<hasLanguage> <lang/nob> ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> _:hamsun
+	] ;
+	<hasSubject> _:hamsun ;
+	<hasSubject> [
+		a <Person> ;
+		<hasName> "Henrik Ibsen" ;
+		<hasBirthDate> [
+			a <Date> ;
+			<hasYear> "1828"^^xsd:int
+		] ;
+		<hasDeathDate> [
+			a <Date> ;
+			<hasYear> "1906"^^xsd:int
+		]
+	] ;
+	<hasSubject> [
+		a <Corporation> ;
+		<hasName> "Gyldendal norsk forlag"
+	] ;
+	<hasSubject> [
+		a <Topic> ;
+		<hasName> "Forfattere -- Norge"
+	] ;
+	<hasSubject> [
+		a <Place> ;
+		<hasName> "Nørholm"
+	] .
+
+_:hamsun a <Person> ;
+	<hasName> "Knut Hamsun" ;
+	<hasBirthDate> [
+		a <Date> ;
+		<hasYear> "1859"^^xsd:int
+	] ;
+	<hasDeathDate> [
+		a <Date> ;
+		<hasYear> "1952"^^xsd:int
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCSeries(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s2015    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Svermere</subfield>
+  </datafield>
+  <datafield tag="490" ind1="1" ind2=" ">
+    <subfield code="a">Gyldendals pocketbøker ;</subfield>
+    <subfield code="v">nr. 12</subfield>
+  </datafield>
+  <datafield tag="490" ind1="0" ind2=" ">
+    <subfield code="a">Hamsun i utvalg</subfield>
+  </datafield>
+  <datafield tag="830" ind1=" " ind2="0">
+    <subfield code="a">Gyldendal pocket</subfield>
+    <subfield code="v">12</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasMainTitle> "Svermere" ;
+	<isPublishedInSeries> [
+		<hasNumber> "12"^^xsd:int ;
+		<inSeries> [
+			a <PublisherSeries> ;
+			<hasName> "Gyldendal pocket"
+		]
+	] ;
+	<isPublishedInSeries> [
+		<inSeries> [
+			a <PublisherSeries> ;
+			<hasName> "Hamsun i utvalg"
+		]
+	] ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Svermere"@nob ;
+		<hasLanguage> <lang/nob>
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCRoles(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s1999    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Goscinny, René</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Asterix og gotere</subfield>
+  </datafield>
+  <datafield tag="246" ind1="1" ind2=" ">
+    <subfield code="i">Originaltittel</subfield>
+    <subfield code="a">Astérix et les Goths</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Uderzo, Albert</subfield>
+    <subfield code="e">ill.</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Hansen, Per Øyvind</subfield>
+    <subfield code="e">overs.</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Berg, Ola</subfield>
+    <subfield code="4">edt</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Charlier, Jean-Michel</subfield>
+    <subfield code="e">forf.</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+<p> a <Publication> ;
+	<hasMainTitle> "Asterix og gotere" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Asterix og gotere"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<isTranslationOf> [
+			a <Work> ;
+			<hasName> "Astérix et les Goths" ;
+			<hasContribution> [
+				a <Contribution> ;
+				<hasRole> <role/author> ;
+				<hasAgent> [
+					a <Person> ;
+					<hasName> "René Goscinny"
+				]
+			] ;
+			<hasContribution> [
+				a <Contribution> ;
+				<hasRole> <role/author> ;
+				<hasAgent> [
+					a <Person> ;
+					<hasName> "Jean-Michel Charlier"
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/illustrator> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Albert Uderzo"
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/translator> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Per Øyvind Hansen"
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/editor> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Ola Berg"
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCCorporations(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s2010    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="110" ind1="2" ind2=" ">
+    <subfield code="a">Norsk polarinstitutt.</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Svalbardboka</subfield>
+  </datafield>
+  <datafield tag="610" ind1="2" ind2="4">
+    <subfield code="a">Norsk polarinstitutt</subfield>
+  </datafield>
+  <datafield tag="710" ind1="2" ind2=" ">
+    <subfield code="a">Universitetet i Tromsø.</subfield>
+    <subfield code="b">Institutt for arktisk biologi</subfield>
+    <subfield code="e">red.</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+<p> a <Publication> ;
+	<hasMainTitle> "Svalbardboka" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Svalbardboka"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> _:npi
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/editor> ;
+			<hasAgent> [
+				a <Corporation> ;
+				<hasName> "Universitetet i Tromsø. Institutt for arktisk biologi"
+			]
+		] ;
+		<hasSubject> _:npi
+	] .
+
+_:npi a <Corporation> ;
+	<hasName> "Norsk polarinstitutt" .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCISBNs(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s2002    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">82-05-30718-0 (ib.)</subfield>
+  </datafield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">978-0-306-40615-7</subfield>
+    <subfield code="q">h.</subfield>
+  </datafield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">0804810345</subfield>
+    <subfield code="z">82-05-30718-4</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+<p> a <Publication> ;
+	<hasISBN> "8205307180" ;
+	<hasISBN> "9788205307186" ;
+	<hasISBN> "0306406152" ;
+	<hasISBN> "9780306406157" ;
+	<hasInvalidISBN> "0804810345" ;
+	<hasInvalidISBN> "8205307184" ;
+	<hasBinding> <binding/hardback> ;
+	<hasISBNBinding> [
+		<hasISBN> "9788205307186" ;
+		<hasBinding> <binding/hardback>
+	] ;
+	<hasISBNBinding> [
+		<hasISBN> "9780306406157" ;
+		<hasBinding> <binding/paperback>
+	] ;
+	<hasMainTitle> "Sult" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"@nob ;
+		<hasLanguage> <lang/nob>
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCNames(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s2002    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="100" ind1="0" ind2=" ">
+    <subfield code="a">Snorri Sturluson</subfield>
+    <subfield code="d">1178 or 1179-1241</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Kongesagaer</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Tolkien, J. R. R.,</subfield>
+    <subfield code="q">(John Ronald Reuel),</subfield>
+    <subfield code="d">1892-1973</subfield>
+  </datafield>
+  <datafield tag="700" ind1="0" ind2=" ">
+    <subfield code="a">Olav</subfield>
+    <subfield code="b">V,</subfield>
+    <subfield code="d">f. 1903</subfield>
+  </datafield>
+  <datafield tag="700" ind1="1" ind2=" ">
+    <subfield code="a">Storm, Gustav,</subfield>
+    <subfield code="d">ca. 1845-</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<p> a <Publication> ;
+	<hasMainTitle> "Kongesagaer" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Kongesagaer"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Snorri Sturluson" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYearLower> "1178"^^xsd:int ;
+					<hasYearUpper> "1179"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1241"^^xsd:int
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "John Ronald Reuel Tolkien" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1892"^^xsd:int
+				] ;
+				<hasDeathDate> [
+					a <Date> ;
+					<hasYear> "1973"^^xsd:int
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Olav V" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1903"^^xsd:int
+				]
+			]
+		] ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasAgent> [
+				a <Person> ;
+				<hasName> "Gustav Storm" ;
+				<hasBirthDate> [
+					a <Date> ;
+					<hasYear> "1845"^^xsd:int ;
+					<isApproximate> "true"^^xsd:boolean
+				]
+			]
+		]
+	] .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCNotesAndContents(t *testing.T) {
+	const input = `<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <controlfield tag="008">150326s2009    no#|||||||||||000|||nob|d</controlfield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Hamsun, Knut</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Noveller :</subfield>
+    <subfield code="b">et utvalg /</subfield>
+    <subfield code="c">Knut Hamsun</subfield>
+  </datafield>
+  <datafield tag="250" ind1=" " ind2=" ">
+    <subfield code="a">2. utg.</subfield>
+  </datafield>
+  <datafield tag="505" ind1="0" ind2=" ">
+    <subfield code="a">Dronningen av Saba / Knut Hamsun -- Livets røst -- Et spøgelse / Knut Hamsun</subfield>
+  </datafield>
+  <datafield tag="520" ind1=" " ind2=" ">
+    <subfield code="a">Noveller fra &lt;1890&gt;-årene.</subfield>
+  </datafield>
+</record>`
+
+	const want = `
+<p> a <Publication> ;
+	<hasMainTitle> "Noveller" ;
+	<hasSubtitle> "et utvalg" ;
+	<hasEditionNote> "2. utg." ;
+	<hasPublisherDescription> "<p>Noveller fra &lt;1890&gt;-årene.</p>" ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Noveller"@nob ;
+		<hasLanguage> <lang/nob> ;
+		<isCompilation> "true"^^<http://www.w3.org/2001/XMLSchema#boolean> ;
+		<hasContribution> [
+			a <Contribution> ;
+			<hasRole> <role/author> ;
+			<hasAgent> _:hamsun
+		] ;
+		<hasPart> [
+			a <Work> ;
+			<hasName> "Dronningen av Saba" ;
+			<hasContribution> [
+				a <Contribution> ;
+				<hasRole> <role/author> ;
+				<hasAgent> _:hamsun
+			]
+		] ;
+		<hasPart> [
+			a <Work> ;
+			<hasName> "Livets røst"
+		] ;
+		<hasPart> [
+			a <Work> ;
+			<hasName> "Et spøgelse" ;
+			<hasContribution> [
+				a <Contribution> ;
+				<hasRole> <role/author> ;
+				<hasAgent> _:hamsun
+			]
+		]
+	] .
+
+_:hamsun a <Person> ;
+	<hasName> "Knut Hamsun" .
+	`
+
+	got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(input), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Eq(mustDecode(want)) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(want)))
+	}
+}
+
+func TestIngestMARCPublicationStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+  <datafield tag="260" ind1=" " ind2=" ">
+    <subfield code="a">Bergen</subfield>
+    <subfield code="b">Eide</subfield>
+    <subfield code="c">1990</subfield>
+  </datafield>
+  <datafield tag="264" ind1=" " ind2="1">
+    <subfield code="a">[Oslo] :</subfield>
+    <subfield code="b">Gyldendal,</subfield>
+    <subfield code="c">[2015]</subfield>
+  </datafield>
+  <datafield tag="264" ind1=" " ind2="2">
+    <subfield code="a">Stavanger :</subfield>
+    <subfield code="b">Distribusjonssentralen</subfield>
+  </datafield>
+  <datafield tag="264" ind1=" " ind2="4">
+    <subfield code="c">©2014</subfield>
+  </datafield>
+</record>`,
+			`
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasPublishYear> "2015"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasCopyrightYear> "2014"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Gyldendal"
+	] ;
+	<hasPubliationPlace> [
+		a <Place> ;
+		<hasName> "Oslo"
+	] ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"
+	] .`,
+		},
+		{
+			`<record>
+  <leader>00715cam a2200241 c 4500</leader>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Sult</subfield>
+  </datafield>
+  <datafield tag="260" ind1=" " ind2=" ">
+    <subfield code="a">[S.l.] :</subfield>
+    <subfield code="b">Tiden,</subfield>
+    <subfield code="c">c2014</subfield>
+  </datafield>
+</record>`,
+			`
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasPublishYear> "2014"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasCopyrightYear> "2014"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasPublisher> [
+		a <Corporation> ;
+		<hasName> "Tiden"
+	] ;
+	<isPublicationOf> [
+		a <Work> ;
+		<hasName> "Sult"
+	] .`,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewBufferString(test.input), sourceOria)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Eq(mustDecode(test.want)) {
+			t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(mustDecode(test.want)))
+		}
+	}
+}
+
+func TestMARCPublicationYears(t *testing.T) {
+	tests := []struct {
+		input           string
+		year, copyright string
+	}{
+		{"2015", "2015", ""},
+		{"[2015?]", "2015", ""},
+		{"c2014", "", "2014"},
+		{"©2014", "", "2014"},
+		{"2015, cop. 2014", "2015", "2014"},
+		{"2015, c2014.", "2015", "2014"},
+		{"[c2014]", "", "2014"},
+	}
+
+	for _, test := range tests {
+		year, copyright := marcPublicationYears(test.input)
+		if year != test.year || copyright != test.copyright {
+			t.Errorf("marcPublicationYears(%q) => %q, %q; want %q, %q",
+				test.input, year, copyright, test.year, test.copyright)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// reISBNPrefix matches a prefix like "ISBN", "ISBN:" or "ISBN-13:".
+var reISBNPrefix = regexp.MustCompile(`(?i)^\s*ISBN(-1[03])?:?`)
+
+// normalizeISBN returns the ISBN in s without hyphens, spaces, prefix and
+// qualifiers, like "ISBN 82-05-30718-0 (ib.)". It returns false if s does
+// not contain a valid ISBN-10 or ISBN-13.
+func normalizeISBN(s string) (string, bool) {
+	s = reISBNPrefix.ReplaceAllString(s, "")
+	i := strings.IndexAny(s, "0123456789")
+	if i < 0 {
+		return "", false
+	}
+	isbn := make([]byte, 0, 13)
+	for _, r := range s[i:] {
+		if r >= '0' && r <= '9' {
+			isbn = append(isbn, byte(r))
+		} else if (r == 'X' || r == 'x') && len(isbn) == 9 {
+			isbn = append(isbn, 'X')
+		} else if r != '-' && r != ' ' {
+			break
+		}
+	}
+	switch len(isbn) {
+	case 10:
+		return string(isbn), isbn10Check(isbn[:9]) == isbn[9]
+	case 13:
+		return string(isbn), isbn13Check(isbn[:12]) == isbn[12]
+	default:
+		return string(isbn), false
+	}
+}
+
+// isbn10Check returns the check digit of an ISBN-10, given the first 9 digits.
+func isbn10Check(digits []byte) byte {
+	sum := 0
+	for i, d := range digits {
+		sum += (10 - i) * int(d-'0')
+	}
+	if c := (11 - sum%11) % 11; c < 10 {
+		return byte('0' + c)
+	}
+	return 'X'
+}
+
+// isbn13Check returns the check digit of an ISBN-13, given the first 12 digits.
+func isbn13Check(digits []byte) byte {
+	sum := 0
+	for i, d := range digits {
+		if i%2 == 0 {
+			sum += int(d - '0')
+		} else {
+			sum += 3 * int(d-'0')
+		}
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// isbnForms returns the ISBN-13 form, and the ISBN-10 form if there is one,
+// of a valid, normalized ISBN.
+func isbnForms(isbn string) (isbn13, isbn10 string) {
+	if len(isbn) == 10 {
+		b := []byte("978" + isbn[:9])
+		return string(append(b, isbn13Check(b))), isbn
+	}
+	if strings.HasPrefix(isbn, "978") {
+		b := []byte(isbn[3:12])
+		return isbn, string(append(b, isbn10Check(b)))
+	}
+	return isbn, ""
+}
+
+// insertISBN inserts both the ISBN-13 and ISBN-10 forms of the ISBN in s,
+// or flags it as invalid. It returns the ISBN-13, or an empty string if
+// the ISBN is invalid.
+func insertISBN(g *memory.Graph, id rdf.NamedNode, s string) string {
+	isbn, ok := normalizeISBN(s)
+	if !ok {
+		insertInvalidISBN(g, id, s)
+		return ""
+	}
+	isbn13, isbn10 := isbnForms(isbn)
+	g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasISBN"), rdf.NewStrLiteral(isbn13)})
+	if isbn10 != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasISBN"), rdf.NewStrLiteral(isbn10)})
+	}
+	return isbn13
+}
+
+// insertInvalidISBN flags the ISBN in s as invalid or cancelled.
+func insertInvalidISBN(g *memory.Graph, id rdf.NamedNode, s string) {
+	isbn, _ := normalizeISBN(s)
+	if isbn == "" {
+		isbn = strings.TrimSpace(s)
+	}
+	if isbn != "" {
+		g.Insert(rdf.Triple{id, rdf.NewNamedNode("hasInvalidISBN"), rdf.NewStrLiteral(isbn)})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"0804810346", "0804810346", true},
+		{"0-8048-1034-6", "0804810346", true},
+		{"82-05-30718-0 (ib.)", "8205307180", true},
+		{"ISBN 978-0-306-40615-7", "9780306406157", true},
+		{"ISBN-13: 978-0-306-40615-7", "9780306406157", true},
+		{"ISBN-10: 0-8048-1034-6", "0804810346", true},
+		{"isbn:0804810346", "0804810346", true},
+		{"080442957x", "080442957X", true},
+		{"0804810345", "0804810345", false},
+		{"9780306406158", "9780306406158", false},
+		{"12345", "12345", false},
+		{"(ib.)", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := normalizeISBN(test.input)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("normalizeISBN(%q) => %q, %v; want %q, %v", test.input, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestISBNForms(t *testing.T) {
+	tests := []struct {
+		input          string
+		isbn13, isbn10 string
+	}{
+		{"0804810346", "9780804810340", "0804810346"},
+		{"080442957X", "9780804429573", "080442957X"},
+		{"9788205307186", "9788205307186", "8205307180"},
+		{"9791032300824", "9791032300824", ""},
+	}
+
+	for _, test := range tests {
+		isbn13, isbn10 := isbnForms(test.input)
+		if isbn13 != test.isbn13 || isbn10 != test.isbn10 {
+			t.Errorf("isbnForms(%q) => %q, %q; want %q, %q", test.input, isbn13, isbn10, test.isbn13, test.isbn10)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // globals
@@ -79,6 +80,11 @@ func main() {
 		metadataAddr = flag.String("metadata-addr", ":7001", "metadata service listening address")
 		metadataDB   = flag.String("metadata-db", "metadata.db", "metadata database")
 		metadataNS   = flag.String("metadata-ns", "", "metadata namespace (RDF resource base URI)")
+		oriaSRU      = flag.String("oria-sru", "https://bibsys.alma.exlibrisgroup.com/view/sru/47BIBSYS_NETWORK", "Oria SRU endpoint")
+		oriaOAI      = flag.String("oria-oai", "", "Oria OAI-PMH endpoint to harvest from (no harvesting if empty)")
+		oriaOAISet   = flag.String("oria-oai-set", "", "Oria OAI-PMH set to harvest")
+		harvestEvery = flag.Duration("harvest-interval", time.Hour, "time between harvests")
+		mergeRules   = flag.String("merge-rules", "", "JSON file with the precedence of sources per property (default rules if empty)")
 		//adminAddr    = flag.String("admin-addr", ":7007", "admin interface listening address")
 	)
 
@@ -86,6 +92,22 @@ func main() {
 
 	metadata := newMetadataService(*metadataAddr, *metadataDB, *metadataNS)
 	metadata.searchService = newSearchService(*enduserLang)
+	metadata.oria = newSRUClient(*oriaSRU)
+	if *oriaOAI != "" {
+		metadata.oriaOAI = newOAIHarvester(*oriaOAI, *oriaOAISet)
+		metadata.harvestInterval = *harvestEvery
+	}
+	if *mergeRules != "" {
+		f, err := os.Open(*mergeRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		metadata.mergeRules, err = loadMergeRules(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	enduser := newEndUserService(*enduserAddr, *enduserLang, metadata)
 
 	m := newMormorMain(metadata, enduser)
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+	"github.com/knakk/mormor/entity"
+)
+
+// marcRecord is a MARC 21 bibliographic record to be exported.
+type marcRecord struct {
+	leader string
+	fields []marcExportField
+}
+
+// marcExportField is a control field, with a value, or a data field, with
+// indicators and subfields.
+type marcExportField struct {
+	tag        string
+	value      string
+	ind1, ind2 byte
+	subfields  []marcSubfield
+}
+
+type marcSubfield struct {
+	code  byte
+	value string
+}
+
+// marcLeader is the leader of exported records: a new record of language
+// material, a monograph, in Unicode, with ISBD punctuation omitted. The
+// record length and base address are filled in by encodeISO2709.
+const marcLeader = "00000nam a2200000 c 4500"
+
+// addControl adds a control field to the record.
+func (r *marcRecord) addControl(tag, value string) {
+	r.fields = append(r.fields, marcExportField{tag: tag, value: value})
+}
+
+// addData adds a data field to the record, with the subfields given as
+// pairs of codes and values. Subfields with empty values are left out, and
+// so is the field if none are left.
+func (r *marcRecord) addData(tag string, ind1, ind2 byte, subfields ...string) {
+	f := marcExportField{tag: tag, ind1: ind1, ind2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if subfields[i+1] != "" {
+			f.subfields = append(f.subfields, marcSubfield{code: subfields[i][0], value: subfields[i+1]})
+		}
+	}
+	if len(f.subfields) > 0 {
+		r.fields = append(r.fields, f)
+	}
+}
+
+// sortFields orders the fields by tag, keeping the order of fields with
+// the same tag.
+func (r *marcRecord) sortFields() {
+	sort.SliceStable(r.fields, func(i, j int) bool {
+		return r.fields[i].tag < r.fields[j].tag
+	})
+}
+
+// encodeXML writes the record as a MARCXML record element. The namespace
+// is declared if xmlns is true, as when the record is not in a collection.
+func (r *marcRecord) encodeXML(w io.Writer, xmlns bool) error {
+	var b bytes.Buffer
+	if xmlns {
+		b.WriteString(`<record xmlns="http://www.loc.gov/MARC21/slim">`)
+	} else {
+		b.WriteString("<record>")
+	}
+	b.WriteString("<leader>")
+	b.WriteString(r.leader)
+	b.WriteString("</leader>")
+	for _, f := range r.fields {
+		if f.subfields == nil {
+			b.WriteString(`<controlfield tag="` + f.tag + `">`)
+			xml.EscapeText(&b, []byte(f.value))
+			b.WriteString("</controlfield>")
+			continue
+		}
+		fmt.Fprintf(&b, `<datafield tag="%s" ind1="%c" ind2="%c">`, f.tag, f.ind1, f.ind2)
+		for _, sf := range f.subfields {
+			fmt.Fprintf(&b, `<subfield code="%c">`, sf.code)
+			xml.EscapeText(&b, []byte(sf.value))
+			b.WriteString("</subfield>")
+		}
+		b.WriteString("</datafield>")
+	}
+	b.WriteString("</record>")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ISO 2709 delimiters.
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+)
+
+// encodeISO2709 writes the record in the MARC 21 exchange format (ISO 2709).
+func (r *marcRecord) encodeISO2709(w io.Writer) error {
+	var dir, data bytes.Buffer
+	for _, f := range r.fields {
+		start := data.Len()
+		if f.subfields == nil {
+			data.WriteString(f.value)
+		} else {
+			data.WriteByte(f.ind1)
+			data.WriteByte(f.ind2)
+			for _, sf := range f.subfields {
+				data.WriteByte(marcSubfieldDelimiter)
+				data.WriteByte(sf.code)
+				data.WriteString(sf.value)
+			}
+		}
+		data.WriteByte(marcFieldTerminator)
+		length := data.Len() - start
+		if length > 9999 {
+			return errors.New("encodeISO2709: field " + f.tag + " too long")
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.tag, length, start)
+	}
+	dir.WriteByte(marcFieldTerminator)
+	data.WriteByte(marcRecordTerminator)
+
+	base := len(r.leader) + dir.Len()
+	length := base + data.Len()
+	if length > 99999 {
+		return errors.New("encodeISO2709: record too long")
+	}
+	leader := fmt.Sprintf("%05d%s%05d%s", length, r.leader[5:12], base, r.leader[17:])
+	if _, err := io.WriteString(w, leader); err != nil {
+		return err
+	}
+	if _, err := w.Write(dir.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data.Bytes())
+	return err
+}
+
+// marcExportPublication is a Publication, as exported to MARC.
+type marcExportPublication struct {
+	URI           string             `rdf:"id"`
+	Title         string             `rdf:"->hasMainTitle"`
+	Subtitle      string             `rdf:"->hasSubtitle"`
+	PublishYear   int                `rdf:"->hasPublishYear"`
+	CopyrightYear int                `rdf:"->hasCopyrightYear"`
+	Places        []string           `rdf:">>hasPubliationPlace;->hasName"`
+	Publisher     string             `rdf:"->hasPublisher;->hasName"`
+	NumPages      int                `rdf:"->hasNumPages"`
+	ISBN          []string           `rdf:">>hasISBN"`
+	InvalidISBN   []string           `rdf:">>hasInvalidISBN"`
+	ISBNBindings  []marcExportISBN   `rdf:">>hasISBNBinding"`
+	Description   string             `rdf:"->hasPublisherDescription"`
+	EditionNote   string             `rdf:"->hasEditionNote"`
+	Series        []marcExportSeries `rdf:">>isPublishedInSeries"`
+	Work          marcExportWork     `rdf:"->isPublicationOf"`
+}
+
+type marcExportISBN struct {
+	ISBN    string `rdf:"->hasISBN"`
+	Binding string `rdf:"->hasBinding"`
+}
+
+type marcExportSeries struct {
+	Number int    `rdf:"->hasNumber"`
+	Name   string `rdf:"->inSeries;->hasName"`
+}
+
+// marcExportWork is the Work of an exported Publication.
+type marcExportWork struct {
+	OriginalTitle string                   `rdf:"->hasOriginalTitle"`
+	Language      string                   `rdf:"->hasLanguage"`
+	Contributions []marcExportContribution `rdf:">>hasContribution"`
+	Forms         []string                 `rdf:">>hasLiteraryForm"`
+	Subjects      []marcExportAgent        `rdf:">>hasSubject"`
+	TranslationOf *marcExportOriginal      `rdf:"->isTranslationOf"`
+}
+
+// marcExportOriginal is the original of a translated Work.
+type marcExportOriginal struct {
+	Name          string                   `rdf:"->hasName"`
+	Contributions []marcExportContribution `rdf:">>hasContribution"`
+}
+
+type marcExportContribution struct {
+	Role  string          `rdf:"->hasRole"`
+	Agent marcExportAgent `rdf:"->hasAgent"`
+}
+
+// marcExportAgent is an agent or a subject of an exported Work.
+type marcExportAgent struct {
+	URI          string       `rdf:"id"`
+	Name         string       `rdf:"->hasName"`
+	BirthDate    *entity.Date `rdf:"->hasBirthDate"`
+	DeathDate    *entity.Date `rdf:"->hasDeathDate"`
+	AuthorityIDs []string     `rdf:">>hasAuthorityID"`
+}
+
+// lifespan returns the birth and death dates of the agent, as in X00 $d.
+func (a marcExportAgent) lifespan() string {
+	if a.BirthDate == nil && a.DeathDate == nil {
+		return ""
+	}
+	var s string
+	if a.BirthDate != nil {
+		s = a.BirthDate.String()
+	}
+	s += "-"
+	if a.DeathDate != nil {
+		s += a.DeathDate.String()
+	}
+	return s
+}
+
+// marcExportBindings are the binding qualifiers (020 $q) of bindings.
+var marcExportBindings = map[string]string{
+	"binding/hardback":  "innb.",
+	"binding/paperback": "h.",
+}
+
+// marcFromGraph maps the Publication uri described in g to a MARC record,
+// entered on file at the given time. It is the reverse of ingestMARC, where
+// the MARC fields are the ones ingestMARC reads.
+func marcFromGraph(g *memory.Graph, uri rdf.NamedNode, entered time.Time) (*marcRecord, error) {
+	var p marcExportPublication
+	if err := g.Decode(&p, uri, rdf.NewNamedNode(""), nil); err != nil {
+		return nil, err
+	}
+	if p.Title == "" {
+		return nil, errors.New("marcFromGraph: " + uri.Name() + " has no title")
+	}
+	rec := &marcRecord{leader: marcLeader}
+	rec.addControl("001", uri.Name())
+
+	// Fixed-length data elements. What is not known is left with fill
+	// characters.
+	f008 := []byte(strings.Repeat("|", 40))
+	copy(f008[0:6], entered.UTC().Format("060102"))
+	copy(f008[6:], "s")
+	if p.PublishYear != 0 {
+		copy(f008[7:11], fmt.Sprintf("%04d", p.PublishYear))
+	} else {
+		copy(f008[7:11], "uuuu")
+	}
+	copy(f008[11:15], "    ")
+	if code := literaryFormCode(p.Work.Forms); code != "" {
+		f008[33] = code[0]
+	}
+	if lang := strings.TrimPrefix(p.Work.Language, "lang/"); len(lang) == 3 {
+		copy(f008[35:38], lang)
+	}
+	copy(f008[38:], " d")
+	rec.addControl("008", string(f008))
+
+	bindings := make(map[string]string)
+	for _, b := range p.ISBNBindings {
+		bindings[b.ISBN] = marcExportBindings[b.Binding]
+	}
+	// Both forms of the ISBNs are exported, the ISBN-13s first. The
+	// bindings are given with the ISBN-13s, as they are ingested.
+	sort.Slice(p.ISBN, func(i, j int) bool {
+		if len(p.ISBN[i]) != len(p.ISBN[j]) {
+			return len(p.ISBN[i]) > len(p.ISBN[j])
+		}
+		return p.ISBN[i] < p.ISBN[j]
+	})
+	for _, isbn := range p.ISBN {
+		rec.addData("020", ' ', ' ', "a", isbn, "q", bindings[isbn])
+	}
+	sort.Strings(p.InvalidISBN)
+	for _, isbn := range p.InvalidISBN {
+		rec.addData("020", ' ', ' ', "z", isbn)
+	}
+
+	// The first author of the Work, or of the original of a translation,
+	// is the main entry.
+	var contribs []marcExportContribution
+	if p.Work.TranslationOf != nil {
+		contribs = append(contribs, p.Work.TranslationOf.Contributions...)
+	}
+	contribs = append(contribs, p.Work.Contributions...)
+	mainEntry := -1
+	for i, c := range contribs {
+		if c.Role == "role/author" {
+			mainEntry = i
+			break
+		}
+	}
+	for i, c := range contribs {
+		tag := "00"
+		if entity.TypeFromURI(rdf.NewNamedNode(c.Agent.URI)) == entity.TypeCorporation {
+			tag = "10"
+		}
+		if i == mainEntry {
+			tag = "1" + tag
+		} else {
+			tag = "7" + tag
+		}
+		addAgent(rec, tag, c.Agent, relatorCode(c.Role))
+	}
+
+	if p.Work.TranslationOf != nil {
+		rec.addData("246", '1', ' ', "i", "Originaltittel", "a", p.Work.TranslationOf.Name)
+	} else {
+		rec.addData("240", '1', '0', "a", p.Work.OriginalTitle)
+	}
+
+	ind1 := byte('0')
+	if mainEntry >= 0 {
+		ind1 = '1'
+	}
+	rec.addData("245", ind1, '0', "a", p.Title, "b", p.Subtitle)
+	rec.addData("250", ' ', ' ', "a", p.EditionNote)
+
+	var statement []string
+	for _, place := range p.Places {
+		statement = append(statement, "a", place)
+	}
+	statement = append(statement, "b", p.Publisher)
+	if p.PublishYear != 0 {
+		statement = append(statement, "c", strconv.Itoa(p.PublishYear))
+	}
+	rec.addData("264", ' ', '1', statement...)
+	if p.CopyrightYear != 0 && p.CopyrightYear != p.PublishYear {
+		rec.addData("264", ' ', '4', "c", "©"+strconv.Itoa(p.CopyrightYear))
+	}
+
+	if p.NumPages != 0 {
+		rec.addData("300", ' ', ' ', "a", strconv.Itoa(p.NumPages)+" s.")
+	}
+
+	for _, s := range p.Series {
+		var number string
+		if s.Number != 0 {
+			number = strconv.Itoa(s.Number)
+		}
+		rec.addData("490", '1', ' ', "a", s.Name, "v", number)
+		rec.addData("830", ' ', '0', "a", s.Name, "v", number)
+	}
+
+	// The description is HTML, with a paragraph per summary.
+	for _, para := range strings.Split(p.Description, "</p>") {
+		para = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(para), "<p>"))
+		rec.addData("520", ' ', ' ', "a", html.UnescapeString(para))
+	}
+
+	for _, s := range p.Work.Subjects {
+		switch entity.TypeFromURI(rdf.NewNamedNode(s.URI)) {
+		case entity.TypePerson:
+			addAgent(rec, "600", s, "")
+		case entity.TypeCorporation:
+			addAgent(rec, "610", s, "")
+		default:
+			tag := "650"
+			if strings.HasPrefix(s.URI, "place/") {
+				tag = "651"
+			}
+			heading := strings.Split(s.Name, " -- ")
+			subfields := []string{"a", heading[0]}
+			for _, sub := range heading[1:] {
+				subfields = append(subfields, "x", sub)
+			}
+			rec.addData(tag, ' ', '4', subfields...)
+		}
+	}
+
+	rec.sortFields()
+	return rec, nil
+}
+
+// addAgent adds a X00 or X10 field for the agent a, with the relator code.
+func addAgent(rec *marcRecord, tag string, a marcExportAgent, relator string) {
+	var subfields []string
+	ind1, ind2 := byte('1'), byte(' ')
+	if strings.HasSuffix(tag, "10") {
+		ind1 = '2'
+		subfields = append(subfields, "a", a.Name)
+	} else {
+		name := invertName(a.Name)
+		if !strings.Contains(name, ",") {
+			ind1 = '0'
+		}
+		subfields = append(subfields, "a", name, "d", a.lifespan())
+	}
+	if tag[0] == '6' {
+		ind2 = '4'
+	}
+	subfields = append(subfields, "4", relator)
+	for _, id := range a.AuthorityIDs {
+		subfields = append(subfields, "0", id)
+	}
+	rec.addData(tag, ind1, ind2, subfields...)
+}
+
+// literaryFormCode returns the code in 008 position 33 of the literary
+// forms, if any. The codes for fiction and nonfiction, which are the least
+// specific, sort first, so the last code is used.
+func literaryFormCode(forms []string) string {
+	var codes []string
+	for code, form := range literaryFormCodes {
+		for _, f := range forms {
+			if f == form {
+				codes = append(codes, code)
+			}
+		}
+	}
+	if len(codes) == 0 {
+		return ""
+	}
+	sort.Strings(codes)
+	return codes[len(codes)-1]
+}
+
+// relatorCode returns the relator code of role, if any.
+func relatorCode(role string) string {
+	var res string
+	for code, r := range relatorCodes {
+		if r == role && (res == "" || code < res) {
+			res = code
+		}
+	}
+	return res
+}
+
+// marcPublication returns the MARC record of the Publication uri.
+func (m *metadataService) marcPublication(uri rdf.NamedNode) (*marcRecord, error) {
+	g, err := m.describe(rdf.DescSymmetricRecursive, uri)
+	if err != nil {
+		return nil, err
+	}
+	entered, ok, err := m.firstIngested(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		entered = time.Now()
+	}
+	return marcFromGraph(g, uri, entered)
+}
+
+// marcFormats are the MARC serializations, by file extension.
+var marcFormats = map[string]string{
+	"marcxml": "application/marcxml+xml",
+	"mrc":     "application/marc",
+}
+
+// serveMARC responds with the MARC record of the Publication resource, as
+// MARCXML or ISO 2709 depending on the format, as in marcFormats.
+func (m *metadataService) serveMARC(w http.ResponseWriter, r *http.Request, resource, format string) {
+	if entity.TypeFromURI(rdf.NewNamedNode(resource)) != entity.TypePublication {
+		http.NotFound(w, r)
+		return
+	}
+	rec, err := m.marcPublication(rdf.NewNamedNode(m.ns + resource))
+	if err != nil {
+		// A Publication which is not stored has no title.
+		log.Printf("%s export error: %v", r.URL.Path, err)
+		http.NotFound(w, r)
+		return
+	}
+	var b bytes.Buffer
+	if format == "marcxml" {
+		b.WriteString(xml.Header)
+		err = rec.encodeXML(&b, true)
+	} else {
+		err = rec.encodeISO2709(&b)
+	}
+	if err != nil {
+		log.Printf("%s export error: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", marcFormats[format])
+	w.Write(b.Bytes())
+}
+
+// serveMARCExport responds with the MARC records of all Publications, as a
+// MARCXML collection, or as ISO 2709 with the query parameter "format=mrc".
+// Publications which cannot be exported are logged and skipped.
+func (m *metadataService) serveMARCExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "marcxml"
+	}
+	if _, ok := marcFormats[format]; !ok {
+		http.Error(w, "bad request: unknown format", http.StatusBadRequest)
+		return
+	}
+	p := rdf.NewVariable("p")
+	publications, err := selectNodes(m.triplestore, p, rdf.TriplePattern{p, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+	if err != nil {
+		log.Printf("%s export error: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", marcFormats[format])
+	if format == "marcxml" {
+		io.WriteString(w, xml.Header+`<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+	}
+	n := 0
+	for _, node := range publications {
+		uri, ok := node.(rdf.NamedNode)
+		if !ok {
+			continue
+		}
+		rec, err := m.marcPublication(uri)
+		if err != nil {
+			log.Printf("%s export skipping %s: %v", r.URL.Path, uri.Name(), err)
+			continue
+		}
+		if format == "marcxml" {
+			err = rec.encodeXML(w, false)
+		} else {
+			err = rec.encodeISO2709(w)
+		}
+		if err != nil {
+			log.Printf("%s export skipping %s: %v", r.URL.Path, uri.Name(), err)
+			continue
+		}
+		n++
+	}
+	if format == "marcxml" {
+		io.WriteString(w, "</collection>")
+	}
+	log.Printf("%s exported %d of %d publications", r.URL.Path, n, len(publications))
+}
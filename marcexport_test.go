@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// marcLines returns the fields of rec in a line format, like
+// "245 10 $aSult$broman".
+func marcLines(rec *marcRecord) []string {
+	var res []string
+	for _, f := range rec.fields {
+		if f.subfields == nil {
+			res = append(res, f.tag+" "+f.value)
+			continue
+		}
+		line := fmt.Sprintf("%s %c%c ", f.tag, f.ind1, f.ind2)
+		for _, sf := range f.subfields {
+			line += fmt.Sprintf("$%c%s", sf.code, sf.value)
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+func TestMARCEncodeISO2709(t *testing.T) {
+	rec := &marcRecord{leader: marcLeader}
+	rec.addControl("001", "p1")
+	rec.addData("245", '1', '0', "a", "Sult", "b", "")
+
+	var b bytes.Buffer
+	if err := rec.encodeISO2709(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "00062nam a2200049 c 4500" +
+		"001000300000" + "245000900003" + "\x1e" +
+		"p1\x1e" + "10\x1faSult\x1e" + "\x1d"
+	if b.String() != want {
+		t.Errorf("got:\n%q\nwant:\n%q", b.String(), want)
+	}
+}
+
+func TestMARCEncodeXML(t *testing.T) {
+	rec := &marcRecord{leader: marcLeader}
+	rec.addControl("001", "p1")
+	rec.addData("245", '1', '0', "a", "Sult & kjærlighet")
+
+	var b bytes.Buffer
+	if err := rec.encodeXML(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	want := `<record xmlns="http://www.loc.gov/MARC21/slim">` +
+		`<leader>00000nam a2200000 c 4500</leader>` +
+		`<controlfield tag="001">p1</controlfield>` +
+		`<datafield tag="245" ind1="1" ind2="0"><subfield code="a">Sult &amp; kjærlighet</subfield></datafield>` +
+		`</record>`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+const testMARCExportPublication = `
+<publication/1> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasSubtitle> "roman" ;
+	<hasPublishYear> "2002"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasNumPages> "219"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasISBN> "9788205307186" ;
+	<hasISBN> "8205307180" ;
+	<hasInvalidISBN> "8205307181" ;
+	<hasISBNBinding> [ <hasISBN> "9788205307186" ; <hasBinding> <binding/hardback> ] ;
+	<hasPubliationPlace> <place/1> ;
+	<hasPublisher> <corporation/1> ;
+	<isPublishedInSeries> [ <inSeries> <publisherSeries/1> ; <hasNumber> "12"^^<http://www.w3.org/2001/XMLSchema#int> ] ;
+	<hasPublisherDescription> "<p>Om sult &amp; kjærlighet.</p>" ;
+	<isPublicationOf> <work/1> .
+<place/1> a <Place> ;
+	<hasName> "Oslo" .
+<corporation/1> a <Corporation> ;
+	<hasName> "Gyldendal" .
+<publisherSeries/1> a <PublisherSeries> ;
+	<hasName> "Gyldendal pocket" .
+<work/1> a <Work> ;
+	<hasName> "Sult"@nob ;
+	<hasLanguage> <lang/nob> ;
+	<hasLiteraryForm> <form/fiction> ;
+	<hasLiteraryForm> <form/novel> ;
+	<hasContribution> [
+		a <Contribution> ;
+		<hasRole> <role/author> ;
+		<hasAgent> <person/1> ] ;
+	<hasSubject> <topic/1> .
+<person/1> a <Person> ;
+	<hasName> "Knut Hamsun" ;
+	<hasBirthDate> [ a <Date> ; <hasYear> "1859"^^<http://www.w3.org/2001/XMLSchema#int> ] ;
+	<hasDeathDate> [ a <Date> ; <hasYear> "1952"^^<http://www.w3.org/2001/XMLSchema#int> ] ;
+	<hasAuthorityID> "(NO-TrBIB)90053126" .
+<topic/1> a <Topic> ;
+	<hasName> "Sult -- Skjønnlitteratur" .`
+
+func TestMARCFromGraph(t *testing.T) {
+	entered := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec, err := marcFromGraph(mustDecode(testMARCExportPublication), rdf.NewNamedNode("publication/1"), entered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"001 publication/1",
+		"008 170301s2002    ||||||||||||||||||f|nob d",
+		"020    $a9788205307186$qinnb.",
+		"020    $a8205307180",
+		"020    $z8205307181",
+		"100 1  $aHamsun, Knut$d1859-1952$4aut$0(NO-TrBIB)90053126",
+		"245 10 $aSult$broman",
+		"264  1 $aOslo$bGyldendal$c2002",
+		"300    $a219 s.",
+		"490 1  $aGyldendal pocket$v12",
+		"520    $aOm sult & kjærlighet.",
+		"650  4 $aSult$xSkjønnlitteratur",
+		"830  0 $aGyldendal pocket$v12",
+	}
+	if got := marcLines(rec); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := marcFromGraph(mustDecode(testMARCExportPublication), rdf.NewNamedNode("publication/2"), entered); err == nil {
+		t.Error("want error for Publication without title")
+	}
+}
+
+func TestMARCRoundTrip(t *testing.T) {
+	rec, err := marcFromGraph(mustDecode(testMARCExportPublication), rdf.NewNamedNode("publication/1"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := rec.encodeXML(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	g, err := ingestPublication(rdf.NewNamedNode("p"), &b, sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p struct {
+		ISBN         []string `rdf:">>hasISBN"`
+		InvalidISBN  []string `rdf:">>hasInvalidISBN"`
+		Binding      string   `rdf:"->hasBinding"`
+		ISBNBindings []struct {
+			ISBN    string `rdf:"->hasISBN"`
+			Binding string `rdf:"->hasBinding"`
+		} `rdf:">>hasISBNBinding"`
+	}
+	if err := g.Decode(&p, rdf.NewNamedNode("p"), rdf.NewNamedNode(""), nil); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(p.ISBN)
+	if fmt.Sprint(p.ISBN) != "[8205307180 9788205307186]" {
+		t.Errorf("got ISBNs %v; want [8205307180 9788205307186]", p.ISBN)
+	}
+	if fmt.Sprint(p.InvalidISBN) != "[8205307181]" {
+		t.Errorf("got invalid ISBNs %v; want [8205307181]", p.InvalidISBN)
+	}
+	if p.Binding != "binding/hardback" || len(p.ISBNBindings) != 1 ||
+		p.ISBNBindings[0].ISBN != "9788205307186" || p.ISBNBindings[0].Binding != "binding/hardback" {
+		t.Errorf("got binding %q and ISBN bindings %+v; want 9788205307186 hardback", p.Binding, p.ISBNBindings)
+	}
+}
+
+func TestMARCExportEndpoint(t *testing.T) {
+	// The Publication was entered on file when its title was ingested.
+	m := &metadataService{triplestore: mustDecode(testMARCExportPublication + `
+[] a <http://www.w3.org/1999/02/22-rdf-syntax-ns#Statement> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#subject> <publication/1> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#predicate> <hasMainTitle> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#object> "Sult" ;
+	<hasSource> <source/oria> ;
+	<hasSourceRecordID> "1" ;
+	<hasIngestTime> "2017-03-01T12:00:00Z"^^<http://www.w3.org/2001/XMLSchema#dateTime> .`)}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	get := func(path string, wantStatus int) string {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantStatus {
+			t.Errorf("GET %s => %d; want %d", path, resp.StatusCode, wantStatus)
+		}
+		return string(b)
+	}
+
+	if body := get("/resource/publication/1.marcxml", http.StatusOK); !strings.Contains(body, `<subfield code="a">Sult</subfield>`) ||
+		!strings.Contains(body, `<controlfield tag="008">170301s2002`) {
+		t.Errorf("got MARCXML:\n%s\nwant title Sult, entered on file 2017-03-01", body)
+	}
+	if body := get("/resource/publication/1.mrc", http.StatusOK); !strings.HasSuffix(body, "\x1d") {
+		t.Errorf("got ISO 2709:\n%q\nwant a record", body)
+	}
+	get("/resource/work/1.marcxml", http.StatusNotFound)
+	get("/resource/publication/2.marcxml", http.StatusNotFound)
+
+	body := get("/export/marc", http.StatusOK)
+	if !strings.HasPrefix(body, `<?xml`) || strings.Count(body, "<record>") != 1 {
+		t.Errorf("got export:\n%s\nwant a collection with one record", body)
+	}
+	get("/export/marc?format=pdf", http.StatusBadRequest)
+}
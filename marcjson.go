@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/knakk/kbp/marc"
+)
+
+// newMARCDecoder returns a decoder for the MARC records in input. The
+// serialization (MARCXML, MARC-in-JSON or ISO 2709) is detected from
+// the first bytes of the input.
+func newMARCDecoder(input io.Reader) (*marc.Decoder, error) {
+	r := bufio.NewReader(input)
+	b, err := skipSpace(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b == '<':
+		return marc.NewDecoder(r, marc.MARCXML), nil
+	case b == '{' || b == '[':
+		// The MARC decoder doesn't know MARC-in-JSON, so we convert
+		// the records to MARCXML first.
+		var buf bytes.Buffer
+		if err := marcJSONToXML(&buf, r); err != nil {
+			return nil, err
+		}
+		return marc.NewDecoder(&buf, marc.MARCXML), nil
+	case b >= '0' && b <= '9':
+		return marc.NewDecoder(r, marc.MARC), nil
+	default:
+		return nil, errors.New("newMARCDecoder: unknown MARC serialization")
+	}
+}
+
+// marcJSONRecord is a record in MARC-in-JSON
+// (http://dilettantes.code4lib.org/blog/2010/09/a-proposal-to-serialize-marc-in-json/).
+type marcJSONRecord struct {
+	Leader string                       `json:"leader"`
+	Fields []map[string]json.RawMessage `json:"fields"`
+}
+
+type marcJSONDataField struct {
+	Ind1      string              `json:"ind1"`
+	Ind2      string              `json:"ind2"`
+	Subfields []map[string]string `json:"subfields"`
+}
+
+// marcJSONToXML converts MARC-in-JSON records from r into a MARCXML
+// collection written to w. The input can be a single record, an array
+// of records, or a stream of records.
+func marcJSONToXML(w io.Writer, r io.Reader) error {
+	io.WriteString(w, `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		var recs []marcJSONRecord
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := json.Unmarshal(raw, &recs); err != nil {
+				return err
+			}
+		} else {
+			var rec marcJSONRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+		}
+		for _, rec := range recs {
+			if err := writeMARCJSONRecord(w, rec); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, `</collection>`)
+	return err
+}
+
+func writeMARCJSONRecord(w io.Writer, rec marcJSONRecord) error {
+	io.WriteString(w, "<record><leader>")
+	xml.EscapeText(w, []byte(rec.Leader))
+	io.WriteString(w, "</leader>")
+	for _, f := range rec.Fields {
+		for tag, v := range f {
+			if len(tag) != 3 {
+				return errors.New("marcJSONToXML: invalid tag: " + tag)
+			}
+			if tag < "010" {
+				var s string
+				if err := json.Unmarshal(v, &s); err != nil {
+					return err
+				}
+				io.WriteString(w, `<controlfield tag="`+tag+`">`)
+				xml.EscapeText(w, []byte(s))
+				io.WriteString(w, "</controlfield>")
+				continue
+			}
+			var df marcJSONDataField
+			if err := json.Unmarshal(v, &df); err != nil {
+				return err
+			}
+			io.WriteString(w, `<datafield tag="`+tag+`" ind1="`)
+			xml.EscapeText(w, []byte(df.Ind1))
+			io.WriteString(w, `" ind2="`)
+			xml.EscapeText(w, []byte(df.Ind2))
+			io.WriteString(w, `">`)
+			for _, sf := range df.Subfields {
+				// Each subfield is an object with a single key, but
+				// we sort them to have a stable output in any case.
+				codes := make([]string, 0, len(sf))
+				for code := range sf {
+					codes = append(codes, code)
+				}
+				sort.Strings(codes)
+				for _, code := range codes {
+					io.WriteString(w, `<subfield code="`)
+					xml.EscapeText(w, []byte(code))
+					io.WriteString(w, `">`)
+					xml.EscapeText(w, []byte(sf[code]))
+					io.WriteString(w, "</subfield>")
+				}
+			}
+			io.WriteString(w, "</datafield>")
+		}
+	}
+	_, err := io.WriteString(w, "</record>")
+	return err
+}
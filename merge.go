@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// defaultMergeRules are the sources of each Publication property, in order
+// of precedence. The values from the first of the sources which has any are
+// kept, the others are dropped. Sources which are not listed come last.
+// All values of properties without rules are kept. Values without
+// provenance, like manual edits, are not covered by the rules: they are
+// always kept, and do not cause any ingested values to be dropped.
+var defaultMergeRules = map[string][]source{
+	"hasMainTitle":            {sourceOria, sourceNasjonalbiblioteket, sourceLibraryOfCongress, sourceOpenLibrary, sourceGoogle, sourceLibraryThing},
+	"hasSubtitle":             {sourceOria, sourceNasjonalbiblioteket, sourceLibraryOfCongress, sourceOpenLibrary, sourceGoogle, sourceLibraryThing},
+	"hasPublishYear":          {sourceOria, sourceNasjonalbiblioteket, sourceLibraryOfCongress, sourceOpenLibrary, sourceGoogle, sourceLibraryThing},
+	"hasNumPages":             {sourceOria, sourceNasjonalbiblioteket, sourceLibraryOfCongress, sourceOpenLibrary, sourceGoogle, sourceLibraryThing},
+	"hasBinding":              {sourceOria, sourceNasjonalbiblioteket, sourceLibraryOfCongress, sourceOpenLibrary, sourceGoogle, sourceLibraryThing},
+	"hasPublisherDescription": {sourceGoogle, sourceOpenLibrary, sourceLibraryOfCongress, sourceOria, sourceNasjonalbiblioteket},
+	"hasImage":                {sourceOpenLibrary, sourceGoogle},
+}
+
+// loadMergeRules reads merge rules from r, as a JSON object of properties and
+// source names, like {"hasNumPages": ["oria", "nb"]}.
+func loadMergeRules(r io.Reader) (map[string][]source, error) {
+	var names map[string][]string
+	if err := json.NewDecoder(r).Decode(&names); err != nil {
+		return nil, err
+	}
+	rules := make(map[string][]source, len(names))
+	for prop, sources := range names {
+		for _, name := range sources {
+			s, ok := sourceNames[name]
+			if !ok {
+				return nil, fmt.Errorf("loadMergeRules: %s: unknown source %q", prop, name)
+			}
+			rules[prop] = append(rules[prop], s)
+		}
+	}
+	return rules, nil
+}
+
+// rank returns the precedence of the source s in rule, where lower is better.
+func rank(rule []source, s source) int {
+	for i, r := range rule {
+		if r == s {
+			return i
+		}
+	}
+	return len(rule)
+}
+
+// mergeConflict is a property of a Publication given different values by
+// different sources, and which of them were kept.
+type mergeConflict struct {
+	Property string         `json:"property"`
+	Kept     sourceValues   `json:"kept"`
+	Dropped  []sourceValues `json:"dropped"`
+}
+
+// sourceValues are the values of a property from a source.
+type sourceValues struct {
+	Source string   `json:"source"`
+	Values []string `json:"values"`
+}
+
+// superseded are the values of a property from a source which an
+// ingest replaces.
+type superseded struct {
+	source   source
+	property string
+}
+
+// mergeIngested applies the merge rules to the graph g of the Publication id
+// ingested from the source s, and the values the other sources have given
+// the Publication earlier. Values from sources with lower precedence are
+// dropped from g, and the values in the triplestore from sources with lower
+// precedence than s are to be superseded when storing g.
+func (m *metadataService) mergeIngested(g *memory.Graph, id rdf.NamedNode, s source) (*memory.Graph, []mergeConflict, []superseded, error) {
+	rules := m.mergeRules
+	if rules == nil {
+		rules = defaultMergeRules
+	}
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		conflicts  []mergeConflict
+		supersedes []superseded
+		drop       = make(map[string]bool)
+	)
+	props := make([]string, 0, len(rules))
+	for prop := range rules {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+	for _, prop := range props {
+		rule := rules[prop]
+		incoming := sourceValues{Source: s.String()}
+		for _, tr := range trs {
+			if tr.Subject == id && tr.Predicate == rdf.NewNamedNode(prop) {
+				incoming.Values = append(incoming.Values, tr.Object.String())
+			}
+		}
+		if len(incoming.Values) == 0 {
+			continue
+		}
+
+		var existing []sourceValues
+		for _, o := range sources() {
+			if o == s {
+				continue
+			}
+			values, err := m.sourceValues(id, prop, o)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if len(values.Values) > 0 {
+				existing = append(existing, values)
+			}
+		}
+
+		kept, keptRank := incoming, rank(rule, s)
+		for _, values := range existing {
+			if r := rank(rule, sourceNames[values.Source]); r < keptRank {
+				kept, keptRank = values, r
+			}
+		}
+		var dropped []sourceValues
+		if kept.Source != incoming.Source {
+			dropped = append(dropped, incoming)
+			drop[prop] = true
+		}
+		for _, values := range existing {
+			if o := sourceNames[values.Source]; rank(rule, o) > keptRank {
+				dropped = append(dropped, values)
+				supersedes = append(supersedes, superseded{source: o, property: prop})
+			}
+		}
+		for i := range dropped {
+			if !sameValues(dropped[i].Values, kept.Values) {
+				conflicts = append(conflicts, mergeConflict{Property: prop, Kept: kept, Dropped: dropped})
+				break
+			}
+		}
+	}
+	if len(drop) == 0 {
+		return g, conflicts, supersedes, nil
+	}
+
+	res := memory.NewGraph()
+	for _, tr := range trs {
+		if p, ok := tr.Predicate.(rdf.NamedNode); ok && tr.Subject == id && drop[p.Name()] {
+			continue
+		}
+		res.Insert(tr)
+	}
+	return res, conflicts, supersedes, nil
+}
+
+// sources returns all the sources in sourceNames, ordered by name.
+func sources() []source {
+	names := make([]string, 0, len(sourceNames))
+	for name := range sourceNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]source, len(names))
+	for i, name := range names {
+		res[i] = sourceNames[name]
+	}
+	return res
+}
+
+// sourceValues returns the values of the property of the resource
+// uri in the triplestore, which were ingested from the source s.
+func (m *metadataService) sourceValues(uri rdf.NamedNode, prop string, s source) (sourceValues, error) {
+	st, v := rdf.NewVariable("st"), rdf.NewVariable("v")
+	nodes, err := selectNodes(m.triplestore, v,
+		rdf.TriplePattern{st, rdfSubject, uri},
+		rdf.TriplePattern{st, rdfPredicate, rdf.NewNamedNode(prop)},
+		rdf.TriplePattern{st, rdfObject, v},
+		rdf.TriplePattern{st, rdf.NewNamedNode("hasSource"), s.URI()})
+	if err != nil {
+		return sourceValues{}, err
+	}
+	res := sourceValues{Source: s.String()}
+	for _, n := range nodes {
+		res.Values = append(res.Values, n.String())
+	}
+	return res, nil
+}
+
+// sameValues reports whether a and b have the same values, in any order.
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// supersede deletes the reifications of the values of a property of the
+// resource uri which were ingested from the source of sup, and the values
+// which no other source or manual edit states.
+func (m *metadataService) supersede(uri rdf.NamedNode, sup superseded) error {
+	st := rdf.NewVariable("st")
+	sts, err := selectNodes(m.triplestore, st,
+		rdf.TriplePattern{st, rdf.NewNamedNode("hasSource"), sup.source.URI()},
+		rdf.TriplePattern{st, rdfSubject, uri},
+		rdf.TriplePattern{st, rdfPredicate, rdf.NewNamedNode(sup.property)})
+	if err != nil {
+		return err
+	}
+	for _, n := range sts {
+		tr, err := m.reifiedTriple(n)
+		if err != nil {
+			return err
+		}
+		if err := m.retractStatement(n, tr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samePublication returns the existing Publication with any of the ISBNs
+// of the new Publication id in g, if any. The different sources describing
+// a Publication are merged into one Publication this way.
+func (m *metadataService) samePublication(g *memory.Graph, id rdf.NamedNode) (rdf.NamedNode, bool, error) {
+	c := rdf.NewVariable("c")
+	if nodes, err := selectNodes(m.triplestore, c, rdf.TriplePattern{id, rdf.RDFtype, c}); err != nil || len(nodes) > 0 {
+		return rdf.NamedNode{}, false, err
+	}
+	isbn := rdf.NewVariable("isbn")
+	isbns, err := selectNodes(g, isbn, rdf.TriplePattern{id, rdf.NewNamedNode("hasISBN"), isbn})
+	if err != nil {
+		return rdf.NamedNode{}, false, err
+	}
+	p := rdf.NewVariable("p")
+	for _, n := range isbns {
+		nodes, err := selectNodes(m.triplestore, p,
+			rdf.TriplePattern{p, rdf.NewNamedNode("hasISBN"), n},
+			rdf.TriplePattern{p, rdf.RDFtype, rdf.NewNamedNode("Publication")})
+		if err != nil {
+			return rdf.NamedNode{}, false, err
+		}
+		for _, n := range nodes {
+			if uri, ok := n.(rdf.NamedNode); ok && uri != id {
+				return uri, true, nil
+			}
+		}
+	}
+	return rdf.NamedNode{}, false, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestLoadMergeRules(t *testing.T) {
+	rules, err := loadMergeRules(strings.NewReader(`{"hasNumPages": ["nb", "oria"], "hasImage": ["openlibrary"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(rules["hasNumPages"]), fmt.Sprint([]source{sourceNasjonalbiblioteket, sourceOria}); got != want {
+		t.Errorf("got hasNumPages rule %v; want %v", got, want)
+	}
+	if rank(rules["hasNumPages"], sourceOria) != 1 || rank(rules["hasNumPages"], sourceGoogle) != 2 {
+		t.Errorf("unlisted sources must come last")
+	}
+
+	if _, err := loadMergeRules(strings.NewReader(`{"hasNumPages": ["nope"]}`)); err == nil {
+		t.Error("want error for unknown source")
+	}
+}
+
+func TestMergeIngested(t *testing.T) {
+	m := &metadataService{triplestore: mustDecode(`<p> <hasNote> "manual" .`)}
+	store := func(s source, recordID, data string) {
+		if err := m.insertIngested(mustDecode(data), provenance{source: s, recordID: recordID, time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := func(p string) []rdf.Node {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("o"),
+			rdf.TriplePattern{rdf.NewNamedNode("p"), rdf.NewNamedNode(p), rdf.NewVariable("o")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodes
+	}
+
+	store(sourceGoogle, "g1", `
+<p> a <Publication> ;
+	<hasNumPages> "210"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasPublisherDescription> "From Google" .`)
+
+	g := mustDecode(`
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasNumPages> "219"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<hasPublisherDescription> "From Oria" .`)
+	g, conflicts, supersedes, err := m.mergeIngested(g, rdf.NewNamedNode("p"), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The page count from Oria is preferred, and the description from Google.
+	got := make(map[string]string)
+	for _, c := range conflicts {
+		var dropped []string
+		for _, d := range c.Dropped {
+			dropped = append(dropped, d.Source)
+		}
+		got[c.Property] = c.Kept.Source + " over " + strings.Join(dropped, ", ")
+	}
+	want := map[string]string{
+		"hasNumPages":             "oria over google",
+		"hasPublisherDescription": "google over oria",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got conflicts %v; want %v", got, want)
+	}
+	if len(supersedes) != 1 || supersedes[0] != (superseded{source: sourceGoogle, property: "hasNumPages"}) {
+		t.Errorf("got supersedes %v; want Google hasNumPages", supersedes)
+	}
+	wantGraph := mustDecode(`
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasNumPages> "219"^^<http://www.w3.org/2001/XMLSchema#int> .`)
+	if !g.Eq(wantGraph) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(g), mustEncode(wantGraph))
+	}
+
+	rep := &ingestReport{Publication: "p", supersedes: supersedes}
+	if err := m.storeIngested(g, rep, provenance{source: sourceOria, recordID: "o1", time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]rdf.Node{
+		"hasNumPages":             rdf.NewTypedLiteral("219", rdf.XSDint),
+		"hasPublisherDescription": rdf.NewStrLiteral("From Google"),
+		"hasMainTitle":            rdf.NewStrLiteral("Sult"),
+		"hasNote":                 rdf.NewStrLiteral("manual"),
+	} {
+		if got := values(p); len(got) != 1 || got[0] != want {
+			t.Errorf("got %s %v; want %v", p, got, want)
+		}
+	}
+
+	// The superseded values are no longer attributed to Google.
+	if v, err := m.sourceValues(rdf.NewNamedNode("p"), "hasNumPages", sourceGoogle); err != nil || len(v.Values) != 0 {
+		t.Errorf("got Google hasNumPages %v, %v; want none", v.Values, err)
+	}
+}
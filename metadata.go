@@ -7,23 +7,34 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/knakk/kbp/rdf"
 	"github.com/knakk/kbp/rdf/disk"
-	"github.com/knakk/kbp/rdf/memory"
 	"github.com/knakk/mormor/entity"
 )
 
 type metadataService struct {
-	addr          string
-	dbPath        string
-	ns            string
-	triplestore   rdf.Graph
-	searchService *searchService
-	indexingQueue chan rdf.NamedNode
-	idcount       int32
+	addr            string
+	dbPath          string
+	ns              string
+	triplestore     rdf.Graph
+	searchService   *searchService
+	oria            *sruClient
+	oriaOAI         *oaiHarvester
+	harvestInterval time.Duration
+	mergeRules      map[string][]source
+	indexingQueue   chan rdf.NamedNode
+	idcount         int32
+
+	// stopHarvest is closed to stop harvesting.
+	stopHarvest chan struct{}
+
+	// storeMu serializes storing ingested records, which replaces the
+	// statements of earlier ingests.
+	storeMu sync.Mutex
 	//ontology  rdf.Ontology
 }
 
@@ -33,6 +44,7 @@ func newMetadataService(addr, dbPath, ns string) *metadataService {
 		dbPath:        dbPath,
 		ns:            ns,
 		indexingQueue: make(chan rdf.NamedNode),
+		stopHarvest:   make(chan struct{}),
 	}
 	go m.processIndexingQueue()
 	return &m
@@ -45,13 +57,21 @@ func (m *metadataService) Start() error {
 	}
 	m.triplestore = db
 
+	if _, err := m.triplestore.Insert(vocabularyTriples()...); err != nil {
+		return err
+	}
+
 	log.Printf("starting metadata service listening at %s", m.addr)
 	m.indexAll()
+	if m.oriaOAI != nil {
+		go m.harvestEvery(m.oriaOAI, "oria", m.harvestInterval)
+	}
 	return http.ListenAndServe(m.addr, m)
 }
 
 func (m *metadataService) Stop() error {
 	log.Println("shutting down metadata service")
+	close(m.stopHarvest)
 
 	if g, ok := m.triplestore.(*disk.Graph); ok {
 		return g.Close()
@@ -102,11 +122,11 @@ func (m *metadataService) nextID(resType string) string {
 	dst[10] = base32[byte(((n>>8)&3<<3)|(n&224>>5))]
 	dst[11] = base32[byte(n)&31]
 
-	return string(dst)
+	return string(dst[:12])
 }
 
 func (m *metadataService) indexAll() error {
-	for _, t := range []entity.Type{entity.TypePerson, entity.TypeWork} {
+	for _, t := range []entity.Type{entity.TypePerson, entity.TypeCorporation, entity.TypeWork} {
 		if err := m.indexType(t); err != nil {
 			return err
 		}
@@ -135,12 +155,12 @@ func (m *metadataService) indexOnly(uri rdf.NamedNode) {
 
 func (m *metadataService) processIndexingQueue() {
 	for uri := range m.indexingQueue {
-		g, err := m.triplestore.Describe(rdf.DescSymmetricRecursive, uri)
+		g, err := m.describe(rdf.DescSymmetricRecursive, uri)
 		if err != nil {
 			log.Printf("desribe resource %v error: %v", uri, err)
 			continue
 		}
-		if err := m.searchService.indexResourceFromGraph(uri, g.(*memory.Graph)); err != nil {
+		if err := m.searchService.indexResourceFromGraph(uri, g); err != nil {
 			log.Printf("indexing %v error: %v", uri, err)
 			continue
 		}
@@ -198,6 +218,18 @@ func (m *metadataService) CreateResource(resType string, body io.Reader) (rdf.Na
 
 func (m *metadataService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
+	if r.URL.Path == "/ingest" {
+		m.serveIngest(w, r)
+		return
+	}
+	if r.URL.Path == "/ingest/batch" {
+		m.serveIngestBatch(w, r)
+		return
+	}
+	if r.URL.Path == "/export/marc" {
+		m.serveMARCExport(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, "/resource/") {
 		http.NotFound(w, r)
 		return
@@ -215,6 +247,12 @@ func (m *metadataService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
+		if i := strings.LastIndex(resources[0], "."); len(resources) == 1 && i > 0 {
+			if _, ok := marcFormats[resources[0][i+1:]]; ok {
+				m.serveMARC(w, r, resources[0][:i], resources[0][i+1:])
+				return
+			}
+		}
 		nodes := make([]rdf.NamedNode, len(resources))
 		for i, r := range resources {
 			nodes[i] = rdf.NewNamedNode(m.ns + r)
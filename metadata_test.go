@@ -341,3 +341,51 @@ func TestOutOfBoundsQ(t *testing.T) {
 		}
 	}
 }
+
+func TestIndexCorporation(t *testing.T) {
+	s := newTestSearchService()
+	g := mustDecode(`
+<corporation/1> a <Corporation> ;
+	<hasName> "Gyldendal norsk forlag" ;
+	<hasAlternativeName> "Gyldendal" .
+<publication/1> <hasPublisher> <corporation/1> .`)
+
+	if err := s.indexResourceFromGraph(rdf.NewNamedNode("corporation/1"), g); err != nil {
+		t.Fatal(err)
+	}
+	testWantSearchResultsToContain(t, s, entity.TypeCorporation, "Gyldendal",
+		doc{Title: "Gyldendal norsk forlag", ID: "corporation/1", Type: "Corporation"})
+}
+
+func TestIndexUnsearchableResources(t *testing.T) {
+	s := newTestSearchService()
+	g := mustDecode(`
+<topic/1> a <Topic> ;
+	<hasName> "Sult" .
+<place/1> a <Place> ;
+	<hasName> "Oslo" .`)
+
+	for _, uri := range []string{"topic/1", "place/1"} {
+		if err := s.indexResourceFromGraph(rdf.NewNamedNode(uri), g); err != nil {
+			t.Errorf("indexing %s: %v", uri, err)
+		}
+	}
+	if res, err := s.queryAll("Sult Oslo"); err != nil || res.NumHits != 0 {
+		t.Errorf("got %+v, %v; want no hits", res, err)
+	}
+}
+
+func TestNextID(t *testing.T) {
+	m := &metadataService{}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := m.nextID("publication")
+		if len(id) != 12 || strings.ContainsAny(id, "\x00") {
+			t.Fatalf("got ID %q; want 12 base32 characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("got ID %q twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/marc"
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+	"github.com/knakk/mormor/entity"
+)
+
+// reinvertName turns an inverted name, like "Hamsun, Knut", into direct
+// order. Anything after a second comma, like "jr.", follows the surname.
+// Names without a comma are returned as they are.
+func reinvertName(s string) string {
+	i := strings.Index(s, ",")
+	if i <= 0 {
+		return strings.TrimSpace(s)
+	}
+	surname, forename := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	var suffix string
+	if j := strings.Index(forename, ","); j >= 0 {
+		forename, suffix = strings.TrimSpace(forename[:j]), strings.TrimSpace(forename[j+1:])
+	}
+	name := surname
+	if forename != "" {
+		name = forename + " " + surname
+	}
+	if suffix != "" {
+		name += " " + suffix
+	}
+	return name
+}
+
+// invertName turns a name in direct order, like "Knut Hamsun", into inverted
+// form, as in MARC X00 $a. It reverses reinvertName, where the last word is
+// taken as the surname, unless it is a suffix like "jr". Names of one word
+// are returned as they are.
+func invertName(s string) string {
+	words := strings.Fields(s)
+	var suffix string
+	if n := len(words); n > 2 && nameSuffixes[strings.ToLower(words[n-1])] {
+		words, suffix = words[:n-1], words[n-1]
+	}
+	if len(words) < 2 {
+		return strings.Join(words, " ")
+	}
+	name := words[len(words)-1] + ", " + strings.Join(words[:len(words)-1], " ")
+	if suffix != "" {
+		name += ", " + suffix
+	}
+	return name
+}
+
+// nameSuffixes are the words following the surname in a name, in lower case.
+var nameSuffixes = map[string]bool{
+	"jr":  true,
+	"jr.": true,
+	"sr":  true,
+	"sr.": true,
+}
+
+// marcName returns the name of the person in a X00 field, in direct order.
+// Names entered under forename (indicator 1 is 0), like royals and Old Norse
+// names as "Snorri Sturluson", are kept as they are, with any numeration
+// ($b), like "Olav V". Other names are reinverted, and a forename of only
+// initials is replaced by its fuller form ($q), if any.
+func marcName(f marc.DField) string {
+	name := trimISBD(marcField1(f, 'a'))
+	if name == "" {
+		return ""
+	}
+	if f.Ind1 == "0" {
+		if b := trimISBD(marcField1(f, 'b')); b != "" {
+			name += " " + b
+		}
+		return name
+	}
+	if q := strings.Trim(marcField1(f, 'q'), "()., "); q != "" {
+		if i := strings.Index(name, ","); i > 0 && onlyInitials(name[i+1:]) {
+			name = name[:i] + ", " + q
+		}
+	}
+	return reinvertName(name)
+}
+
+// onlyInitials reports whether s consists only of initials, like "J. R. R.".
+func onlyInitials(s string) bool {
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '.' || r == '-'
+	})
+	for _, p := range parts {
+		if len([]rune(p)) > 1 {
+			return false
+		}
+	}
+	return len(parts) > 0
+}
+
+var (
+	reBC              = regexp.MustCompile(`(?i)\b(f\.\s*kr|b\.\s*c|bce|bc|fvt)\b\.?`)
+	reAD              = regexp.MustCompile(`(?i)\b(e\.\s*kr|a\.\s*d|evt)\b\.?`)
+	reCenturyDashes   = regexp.MustCompile(`^(\d{1,2})--`)
+	reCenturyOrdinal  = regexp.MustCompile(`^(\d{1,2})\.\s*årh`)
+	reYearAlternative = regexp.MustCompile(`^(\d{1,4})\s*(?:/|or|eller)\s*(\d{1,4})`)
+	reLeadingYear     = regexp.MustCompile(`^\d{1,4}`)
+)
+
+// parseDates parses the birth and death dates of a person, as given in
+// X00 $d, like "1867-1916", "ca. 1850-", "f. 1943", "d. 1920", "1850 or
+// 1851-1920", "18--" or "427-347 f.Kr.". Either date is nil if not given.
+func parseDates(s string) (birth, death *entity.Date) {
+	s = trimISBD(strings.TrimSpace(s))
+	lower := strings.ToLower(s)
+	for _, prefix := range []string{"fl.", "virksom", "active"} {
+		if strings.HasPrefix(lower, prefix) {
+			// Years of activity are neither birth nor death.
+			return nil, nil
+		}
+	}
+	for _, prefix := range []string{"f.", "født", "b.", "born"} {
+		if strings.HasPrefix(lower, prefix) {
+			return parseDate(s[len(prefix):], false), nil
+		}
+	}
+	for _, prefix := range []string{"d.", "død", "died"} {
+		if strings.HasPrefix(lower, prefix) {
+			return nil, parseDate(s[len(prefix):], false)
+		}
+	}
+
+	i := dateSeparator(s)
+	if i < 0 {
+		return parseDate(s, false), nil
+	}
+	b, d := s[:i], s[i+1:]
+
+	// If the death is before Christ, so is the birth, unless stated otherwise.
+	bc := reBC.MatchString(d) && !reAD.MatchString(b)
+	return parseDate(b, bc), parseDate(d, false)
+}
+
+// dateSeparator returns the index of the "-" separating the birth and death
+// dates in s, or -1 if there is none. The dashes of "18--" are not separators.
+func dateSeparator(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' && (i == 0 || s[i-1] != '-') && (i+1 == len(s) || s[i+1] != '-') {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseDate parses a single date of a person, like "1867", "ca. 1850",
+// "1850?", "1850/51" or "19. årh.". Years before Christ are negative.
+// It returns nil if there is no year in s.
+func parseDate(s string, bc bool) *entity.Date {
+	s = strings.TrimSpace(s)
+	if reBC.MatchString(s) {
+		bc = true
+	}
+	s = strings.TrimSpace(reAD.ReplaceAllString(reBC.ReplaceAllString(s, ""), ""))
+
+	var d entity.Date
+	lower := strings.ToLower(s)
+	for _, prefix := range []string{"ca.", "ca", "c.", "omkr.", "omkring"} {
+		if strings.HasPrefix(lower, prefix) {
+			d.Approx = true
+			s = strings.TrimSpace(s[len(prefix):])
+			break
+		}
+	}
+	if strings.Contains(s, "?") {
+		d.Approx = true
+		s = strings.TrimSpace(strings.Replace(s, "?", "", -1))
+	}
+
+	if m := reCenturyDashes.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		d.YearLower, d.YearUpper = n*100, n*100+99
+	} else if m := reCenturyOrdinal.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		d.YearLower, d.YearUpper = (n-1)*100, (n-1)*100+99
+	} else if m := reYearAlternative.FindStringSubmatch(s); m != nil {
+		if len(m[2]) < len(m[1]) {
+			// Abbreviated, like "1850/51"
+			m[2] = m[1][:len(m[1])-len(m[2])] + m[2]
+		}
+		d.YearLower, _ = strconv.Atoi(m[1])
+		d.YearUpper, _ = strconv.Atoi(m[2])
+	} else if m := reLeadingYear.FindString(s); m != "" {
+		d.Year, _ = strconv.Atoi(m)
+	} else {
+		return nil
+	}
+
+	if bc {
+		d.Year = -d.Year
+		d.YearLower, d.YearUpper = -d.YearUpper, -d.YearLower
+	}
+	if d.YearLower > d.YearUpper {
+		d.YearLower, d.YearUpper = d.YearUpper, d.YearLower
+	}
+	return &d
+}
+
+// insertDate inserts the date d as a Date node with the given label,
+// linked from node with the predicate pred.
+func insertDate(g *memory.Graph, node rdf.BlankNode, pred, label string, d *entity.Date) {
+	date := rdf.NewBlankNode(label)
+	g.Insert(
+		rdf.Triple{node, rdf.NewNamedNode(pred), date},
+		rdf.Triple{date, rdf.RDFtype, rdf.NewNamedNode("Date")})
+	if d.Year != 0 {
+		g.Insert(rdf.Triple{date, rdf.NewNamedNode("hasYear"), rdf.NewTypedLiteral(strconv.Itoa(d.Year), rdf.XSDint)})
+	}
+	if d.YearLower != 0 || d.YearUpper != 0 {
+		g.Insert(
+			rdf.Triple{date, rdf.NewNamedNode("hasYearLower"), rdf.NewTypedLiteral(strconv.Itoa(d.YearLower), rdf.XSDint)},
+			rdf.Triple{date, rdf.NewNamedNode("hasYearUpper"), rdf.NewTypedLiteral(strconv.Itoa(d.YearUpper), rdf.XSDint)})
+	}
+	if d.Approx {
+		g.Insert(rdf.Triple{date, rdf.NewNamedNode("isApproximate"), rdf.NewTypedLiteral("true", rdf.XSDboolean)})
+	}
+}
+
+// insertLifespan inserts the birth and death dates of agent, as given in
+// X00 $d (see parseDates). The date nodes are labeled with the given label.
+func insertLifespan(g *memory.Graph, agent rdf.BlankNode, label string, s string) {
+	birth, death := parseDates(s)
+	if birth != nil {
+		insertDate(g, agent, "hasBirthDate", label+"BirthDate", birth)
+	}
+	if death != nil {
+		insertDate(g, agent, "hasDeathDate", label+"DeathDate", death)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/knakk/mormor/entity"
+)
+
+func TestReinvertName(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"Hamsun, Knut", "Knut Hamsun"},
+		{"Natsume, Sōseki", "Sōseki Natsume"},
+		{"Beauvoir, Simone de", "Simone de Beauvoir"},
+		{"Davis, Sammy, jr", "Sammy Davis jr"},
+		{"Hamsun,Knut", "Knut Hamsun"},
+		{"Hamsun,", "Hamsun"},
+		{",", ","},
+		{"Snorri Sturluson", "Snorri Sturluson"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := reinvertName(test.input); got != test.want {
+			t.Errorf("reinvertName(%q) => %q; want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestInvertName(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"Knut Hamsun", "Hamsun, Knut"},
+		{"Simone de Beauvoir", "Beauvoir, Simone de"},
+		{"Sammy Davis jr", "Davis, Sammy, jr"},
+		{"Hamsun", "Hamsun"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := invertName(test.input); got != test.want {
+			t.Errorf("invertName(%q) => %q; want %q", test.input, got, test.want)
+		}
+		if test.input != "" && reinvertName(invertName(test.input)) != test.input {
+			t.Errorf("reinvertName(invertName(%q)) => %q", test.input, reinvertName(invertName(test.input)))
+		}
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	tests := []struct {
+		input        string
+		birth, death *entity.Date
+	}{
+		{"1867-1916", &entity.Date{Year: 1867}, &entity.Date{Year: 1916}},
+		{"1859-1952.", &entity.Date{Year: 1859}, &entity.Date{Year: 1952}},
+		{"1943-", &entity.Date{Year: 1943}, nil},
+		{"ca. 1850-", &entity.Date{Year: 1850, Approx: true}, nil},
+		{"ca. 1850-ca. 1910", &entity.Date{Year: 1850, Approx: true}, &entity.Date{Year: 1910, Approx: true}},
+		{"1850?-1920", &entity.Date{Year: 1850, Approx: true}, &entity.Date{Year: 1920}},
+		{"f. 1943", &entity.Date{Year: 1943}, nil},
+		{"b. 1943", &entity.Date{Year: 1943}, nil},
+		{"d. 1920", nil, &entity.Date{Year: 1920}},
+		{"død 1920", nil, &entity.Date{Year: 1920}},
+		{"fl. 1650", nil, nil},
+		{"1850 or 1851-1920", &entity.Date{YearLower: 1850, YearUpper: 1851}, &entity.Date{Year: 1920}},
+		{"1850/51-1920", &entity.Date{YearLower: 1850, YearUpper: 1851}, &entity.Date{Year: 1920}},
+		{"18--", &entity.Date{YearLower: 1800, YearUpper: 1899}, nil},
+		{"19. årh.", &entity.Date{YearLower: 1800, YearUpper: 1899}, nil},
+		{"427-347 f.Kr.", &entity.Date{Year: -427}, &entity.Date{Year: -347}},
+		{"ca. 4 f.Kr.-65 e.Kr.", &entity.Date{Year: -4, Approx: true}, &entity.Date{Year: 65}},
+		{"384 B.C.-322 B.C.", &entity.Date{Year: -384}, &entity.Date{Year: -322}},
+		{"-1916", nil, &entity.Date{Year: 1916}},
+		{"", nil, nil},
+		{"?", nil, nil},
+	}
+
+	for _, test := range tests {
+		birth, death := parseDates(test.input)
+		if !sameDate(birth, test.birth) || !sameDate(death, test.death) {
+			t.Errorf("parseDates(%q) => %+v, %+v; want %+v, %+v", test.input, birth, death, test.birth, test.death)
+		}
+	}
+}
+
+func sameDate(a, b *entity.Date) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
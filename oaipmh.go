@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oaiHarvester harvests records from an OAI-PMH endpoint, like the one of Oria:
+// https://bibsys.alma.exlibrisgroup.com/view/oai/47BIBSYS_NETWORK/request
+type oaiHarvester struct {
+	endpoint       string
+	metadataPrefix string
+
+	// set is the set to harvest, or all records if empty.
+	set string
+
+	transport httpGetter
+}
+
+func newOAIHarvester(endpoint, set string) *oaiHarvester {
+	return &oaiHarvester{
+		endpoint:       endpoint,
+		metadataPrefix: "marc21",
+		set:            set,
+		transport:      &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// oaiResponse is a ListRecords response.
+type oaiResponse struct {
+	ResponseDate    string      `xml:"responseDate"`
+	Error           *oaiError   `xml:"error"`
+	Records         []oaiRecord `xml:"ListRecords>record"`
+	ResumptionToken string      `xml:"ListRecords>resumptionToken"`
+}
+
+// oaiRecord is a record in a ListRecords response.
+type oaiRecord struct {
+	Header struct {
+		// Status is "deleted" for deleted records.
+		Status     string `xml:"status,attr"`
+		Identifier string `xml:"identifier"`
+		Datestamp  string `xml:"datestamp"`
+	} `xml:"header"`
+	Metadata struct {
+		XML []byte `xml:",innerxml"`
+	} `xml:"metadata"`
+}
+
+// Deleted reports whether the record is deleted.
+func (r oaiRecord) Deleted() bool { return r.Header.Status == "deleted" }
+
+// oaiError is an error in a OAI-PMH response.
+type oaiError struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e *oaiError) Error() string {
+	return fmt.Sprintf("oai-pmh: %s: %s", e.Code, e.Message)
+}
+
+// listRecords fetches a page of records changed between the datestamps from
+// and until (any of them can be empty), or, if token is not empty, the page
+// following the one with the resumption token.
+func (h *oaiHarvester) listRecords(from, until, token string) (*oaiResponse, error) {
+	params := url.Values{"verb": {"ListRecords"}}
+	if token != "" {
+		params.Set("resumptionToken", token)
+	} else {
+		params.Set("metadataPrefix", h.metadataPrefix)
+		if h.set != "" {
+			params.Set("set", h.set)
+		}
+		if from != "" {
+			params.Set("from", from)
+		}
+		if until != "" {
+			params.Set("until", until)
+		}
+	}
+	resp, err := h.transport.Get(h.endpoint + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res oaiResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("oai-pmh: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("oai-pmh: error decoding response: %v", err)
+	}
+	if res.Error != nil {
+		if res.Error.Code == "noRecordsMatch" {
+			return &oaiResponse{ResponseDate: res.ResponseDate}, nil
+		}
+		return nil, res.Error
+	}
+	return &res, nil
+}
+
+// harvest calls fn with every record changed between the datestamps from and
+// until (any of them can be empty), following the resumption tokens. It
+// stops at the first error returned by fn. When all the records are
+// harvested, it returns the responseDate of the first request, which the
+// next harvest can start from. The records are not in datestamp order, so
+// an interrupted harvest cannot be resumed from any of their datestamps.
+func (h *oaiHarvester) harvest(from, until string, fn func(oaiRecord) error) (string, error) {
+	var token, responseDate string
+	for {
+		res, err := h.listRecords(from, until, token)
+		if err != nil {
+			return "", err
+		}
+		if responseDate == "" {
+			responseDate = res.ResponseDate
+		}
+		for _, rec := range res.Records {
+			if err := fn(rec); err != nil {
+				return "", err
+			}
+		}
+		if token = strings.TrimSpace(res.ResumptionToken); token == "" {
+			return responseDate, nil
+		}
+	}
+}
+
+// oaiRecordID returns the local part of an OAI identifier, like
+// "990114007574702201" of "oai:alma.47BIBSYS_NETWORK:990114007574702201",
+// which is the control number (001) of the records from Oria. Other
+// identifiers are returned as they are.
+func oaiRecordID(identifier string) string {
+	if parts := strings.SplitN(identifier, ":", 3); len(parts) == 3 && parts[0] == "oai" {
+		return parts[2]
+	}
+	return identifier
+}
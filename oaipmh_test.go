@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// oaiTestRecord returns a ListRecords record with a MARC record with the
+// given title, or a deleted record if title is empty.
+func oaiTestRecord(id, datestamp, title string) string {
+	if title == "" {
+		return fmt.Sprintf(`
+    <record>
+      <header status="deleted">
+        <identifier>%s</identifier>
+        <datestamp>%s</datestamp>
+      </header>
+    </record>`, id, datestamp)
+	}
+	return fmt.Sprintf(`
+    <record>
+      <header>
+        <identifier>%s</identifier>
+        <datestamp>%s</datestamp>
+      </header>
+      <metadata>
+        <record xmlns="http://www.loc.gov/MARC21/slim">
+          <leader>00715cam a2200241 c 4500</leader>
+          <datafield tag="245" ind1="1" ind2="0">
+            <subfield code="a">%s</subfield>
+          </datafield>
+        </record>
+      </metadata>
+    </record>`, id, datestamp, title)
+}
+
+// oaiTestServer serves the pages of records, keyed by resumption token,
+// where the first page has the empty token. The from parameter must
+// equal wantFrom.
+func oaiTestServer(t *testing.T, wantFrom *string, pages map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		token := q.Get("resumptionToken")
+		if q.Get("verb") != "ListRecords" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if token == "" && (q.Get("metadataPrefix") != "marc21" || q.Get("from") != *wantFrom) {
+			t.Errorf("unexpected request: %s; want from=%s", r.URL, *wantFrom)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/">
+  <responseDate>2017-03-01T12:00:00Z</responseDate>`)
+		records, ok := pages[token]
+		if !ok {
+			fmt.Fprint(w, `
+  <error code="badResumptionToken">The value of the resumptionToken argument is invalid or expired.</error>
+</OAI-PMH>`)
+			return
+		}
+		if len(records) == 0 {
+			fmt.Fprint(w, `
+  <error code="noRecordsMatch">No records match.</error>
+</OAI-PMH>`)
+			return
+		}
+		fmt.Fprint(w, `
+  <ListRecords>`)
+		for _, rec := range records {
+			fmt.Fprint(w, rec)
+		}
+		next := ""
+		if _, ok := pages[token+"+"]; ok {
+			next = token + "+"
+		}
+		fmt.Fprintf(w, `
+    <resumptionToken>%s</resumptionToken>
+  </ListRecords>
+</OAI-PMH>`, next)
+	}))
+}
+
+func TestOAIHarvest(t *testing.T) {
+	from := "2017-01-01"
+	srv := oaiTestServer(t, &from, map[string][]string{
+		"": {
+			oaiTestRecord("oai:test:1", "2017-01-02", "Sult"),
+			oaiTestRecord("oai:test:2", "2017-01-04", "Pan"),
+		},
+		"+": {
+			oaiTestRecord("oai:test:3", "2017-01-03", ""),
+		},
+	})
+	defer srv.Close()
+	h := newOAIHarvester(srv.URL, "")
+
+	var got []string
+	responseDate, err := h.harvest(from, "", func(rec oaiRecord) error {
+		s := rec.Header.Identifier
+		if rec.Deleted() {
+			s += " deleted"
+		} else if !strings.Contains(string(rec.Metadata.XML), "<leader>") {
+			t.Errorf("%s: no MARC record in metadata", rec.Header.Identifier)
+		}
+		got = append(got, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[oai:test:1 oai:test:2 oai:test:3 deleted]"; fmt.Sprint(got) != want {
+		t.Errorf("got records %v; want %s", got, want)
+	}
+	if want := "2017-03-01T12:00:00Z"; responseDate != want {
+		t.Errorf("got responseDate %q; want %s", responseDate, want)
+	}
+}
+
+func TestOAIRecordID(t *testing.T) {
+	for input, want := range map[string]string{
+		"oai:alma.47BIBSYS_NETWORK:990114007574702201": "990114007574702201",
+		"oai:test:a:b":       "a:b",
+		"990114007574702201": "990114007574702201",
+		"http://test.org/1":  "http://test.org/1",
+	} {
+		if got := oaiRecordID(input); got != want {
+			t.Errorf("oaiRecordID(%q) => %q; want %q", input, got, want)
+		}
+	}
+}
+
+func TestOAIErrors(t *testing.T) {
+	from := ""
+	srv := oaiTestServer(t, &from, map[string][]string{"": nil})
+	defer srv.Close()
+	h := newOAIHarvester(srv.URL, "")
+
+	// No records is not an error.
+	res, err := h.listRecords("", "", "")
+	if err != nil || len(res.Records) != 0 {
+		t.Errorf("got %v, %v; want no records and no error", res, err)
+	}
+
+	_, err = h.listRecords("", "", "expired")
+	if e, ok := err.(*oaiError); !ok || e.Code != "badResumptionToken" {
+		t.Errorf("got error %v; want badResumptionToken", err)
+	}
+}
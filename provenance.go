@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+// String returns the name of the source, as in sourceNames.
+func (s source) String() string {
+	for name, src := range sourceNames {
+		if src == s {
+			return name
+		}
+	}
+	return "source(" + strconv.Itoa(int(s)) + ")"
+}
+
+// URI returns the URI of the source, as in the Source vocabulary.
+func (s source) URI() rdf.NamedNode {
+	return rdf.NewNamedNode("source/" + s.String())
+}
+
+const rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+var (
+	rdfStatement = rdf.NewNamedNode(rdfNS + "Statement")
+	rdfSubject   = rdf.NewNamedNode(rdfNS + "subject")
+	rdfPredicate = rdf.NewNamedNode(rdfNS + "predicate")
+	rdfObject    = rdf.NewNamedNode(rdfNS + "object")
+	xsdDateTime  = rdf.NewNamedNode("http://www.w3.org/2001/XMLSchema#dateTime")
+)
+
+// provenance tells where ingested statements come from.
+type provenance struct {
+	source   source
+	recordID string
+	time     time.Time
+}
+
+// reify returns the triples in g, together with a reification of each
+// of them, describing its provenance:
+//
+//	_:st a rdf:Statement ;
+//		rdf:subject <s> ; rdf:predicate <p> ; rdf:object <o> ;
+//		<hasSource> <source/oria> ;
+//		<hasSourceRecordID> "990114007574702201" ;
+//		<hasIngestTime> "2017-03-01T12:00:00Z"^^xsd:dateTime .
+//
+// The statements are labeled with the given prefix.
+func reify(g *memory.Graph, prov provenance, prefix string) ([]rdf.Triple, error) {
+	trs, err := graphTriples(g)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		source   = prov.source.URI()
+		recordID = rdf.NewStrLiteral(prov.recordID)
+		ingested = rdf.NewTypedLiteral(prov.time.UTC().Format(time.RFC3339), xsdDateTime)
+		res      = make([]rdf.Triple, 0, len(trs)*8)
+	)
+	for i, tr := range trs {
+		st := rdf.NewBlankNode(prefix + "s" + strconv.Itoa(i))
+		res = append(res,
+			tr,
+			rdf.Triple{st, rdf.RDFtype, rdfStatement},
+			rdf.Triple{st, rdfSubject, tr.Subject},
+			rdf.Triple{st, rdfPredicate, tr.Predicate},
+			rdf.Triple{st, rdfObject, tr.Object},
+			rdf.Triple{st, rdf.NewNamedNode("hasSource"), source},
+			rdf.Triple{st, rdf.NewNamedNode("hasSourceRecordID"), recordID},
+			rdf.Triple{st, rdf.NewNamedNode("hasIngestTime"), ingested})
+	}
+	return res, nil
+}
+
+// provenancePredicates are the predicates of the reified statements which
+// describe the provenance of ingested statements, see reify.
+var provenancePredicates = map[rdf.Node]bool{
+	rdfSubject:                            true,
+	rdfPredicate:                          true,
+	rdfObject:                             true,
+	rdf.NewNamedNode("hasSource"):         true,
+	rdf.NewNamedNode("hasSourceRecordID"): true,
+	rdf.NewNamedNode("hasIngestTime"):     true,
+}
+
+// describe returns the description of the nodes in the triplestore, like
+// Describe, without the reified statements of their provenance. The
+// statements are linked to the resources they are about, so symmetric
+// descriptions would otherwise include them all.
+func (m *metadataService) describe(mode rdf.DescribeMode, nodes ...rdf.NamedNode) (*memory.Graph, error) {
+	g, err := m.triplestore.Describe(mode, nodes...)
+	if err != nil {
+		return nil, err
+	}
+	trs, err := graphTriples(g.(*memory.Graph))
+	if err != nil {
+		return nil, err
+	}
+	res := memory.NewGraph()
+	for _, tr := range trs {
+		if provenancePredicates[tr.Predicate] || (tr.Predicate == rdf.RDFtype && tr.Object == rdfStatement) {
+			continue
+		}
+		res.Insert(tr)
+	}
+	return res, nil
+}
+
+// recordStatement returns the patterns matching the reified statements
+// ?s ?p ?o ingested from the given source record, as ?st.
+func recordStatement(s source, recordID string) []rdf.TriplePattern {
+	st := rdf.NewVariable("st")
+	return []rdf.TriplePattern{
+		{st, rdf.NewNamedNode("hasSource"), s.URI()},
+		{st, rdf.NewNamedNode("hasSourceRecordID"), rdf.NewStrLiteral(recordID)},
+		{st, rdfSubject, rdf.NewVariable("s")},
+		{st, rdfPredicate, rdf.NewVariable("p")},
+		{st, rdfObject, rdf.NewVariable("o")},
+	}
+}
+
+// recordPublication returns the Publication ingested from the given source
+// record, if any.
+func (m *metadataService) recordPublication(s source, recordID string) (rdf.NamedNode, bool, error) {
+	where := recordStatement(s, recordID)
+	where[3].Object = rdf.RDFtype
+	where[4].Object = rdf.NewNamedNode("Publication")
+	nodes, err := selectNodes(m.triplestore, rdf.NewVariable("s"), where...)
+	if err != nil {
+		return rdf.NamedNode{}, false, err
+	}
+	for _, n := range nodes {
+		if uri, ok := n.(rdf.NamedNode); ok {
+			return uri, true, nil
+		}
+	}
+	return rdf.NamedNode{}, false, nil
+}
+
+// firstIngested returns the earliest ingest time of the statements about
+// the resource uri, if any.
+func (m *metadataService) firstIngested(uri rdf.NamedNode) (time.Time, bool, error) {
+	st := rdf.NewVariable("st")
+	times, err := selectNodes(m.triplestore, rdf.NewVariable("t"),
+		rdf.TriplePattern{st, rdfSubject, uri},
+		rdf.TriplePattern{st, rdf.NewNamedNode("hasIngestTime"), rdf.NewVariable("t")})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var first time.Time
+	for _, n := range times {
+		lit, ok := n.(rdf.Literal)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, lit.String())
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first, !first.IsZero(), nil
+}
+
+// reifyManual returns a reification without a source of each of the triples
+// trs which is already in the triplestore without any reification, like a
+// manual edit. Retracting a record which states the same thing does not
+// delete it then. The statements are labeled with the given prefix.
+func (m *metadataService) reifyManual(trs []rdf.Triple, prefix string) ([]rdf.Triple, error) {
+	var (
+		st  = rdf.NewVariable("st")
+		obj = rdf.NewVariable("o")
+		res []rdf.Triple
+	)
+	for i, tr := range trs {
+		objects, err := selectNodes(m.triplestore, obj, rdf.TriplePattern{tr.Subject, tr.Predicate, obj})
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, o := range objects {
+			if o == tr.Object {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		sts, err := selectNodes(m.triplestore, st,
+			rdf.TriplePattern{st, rdfSubject, tr.Subject},
+			rdf.TriplePattern{st, rdfPredicate, tr.Predicate},
+			rdf.TriplePattern{st, rdfObject, tr.Object})
+		if err != nil {
+			return nil, err
+		}
+		if len(sts) > 0 {
+			continue
+		}
+		manual := rdf.NewBlankNode(prefix + "m" + strconv.Itoa(i))
+		res = append(res,
+			rdf.Triple{manual, rdf.RDFtype, rdfStatement},
+			rdf.Triple{manual, rdfSubject, tr.Subject},
+			rdf.Triple{manual, rdfPredicate, tr.Predicate},
+			rdf.Triple{manual, rdfObject, tr.Object})
+	}
+	return res, nil
+}
+
+// insertIngested inserts the graph g in the triplestore, with the provenance
+// of its statements. The blank nodes of g are inserted as they are, so they
+// must either be ones in the triplestore, like the structures linked by
+// linkStructures, or have unique labels, like the ones given by
+// prepareIngested.
+func (m *metadataService) insertIngested(g *memory.Graph, prov provenance) error {
+	// The statements are labeled after an ID which is unique to this call.
+	prefix := "st" + m.nextID("statement")
+	trs, err := reify(g, prov, prefix)
+	if err != nil {
+		return err
+	}
+	gtrs, err := graphTriples(g)
+	if err != nil {
+		return err
+	}
+	manual, err := m.reifyManual(gtrs, prefix)
+	if err != nil {
+		return err
+	}
+	_, err = m.triplestore.Insert(append(trs, manual...)...)
+	return err
+}
+
+// reifiedTriple returns the triple reified by the statement st.
+func (m *metadataService) reifiedTriple(st rdf.Node) (rdf.Triple, error) {
+	var (
+		tr rdf.Triple
+		v  = rdf.NewVariable("v")
+	)
+	for _, part := range []struct {
+		pred rdf.NamedNode
+		node *rdf.Node
+	}{{rdfSubject, &tr.Subject}, {rdfPredicate, &tr.Predicate}, {rdfObject, &tr.Object}} {
+		nodes, err := selectNodes(m.triplestore, v, rdf.TriplePattern{st, part.pred, v})
+		if err != nil {
+			return tr, err
+		}
+		if len(nodes) == 0 {
+			return tr, fmt.Errorf("reifiedTriple: statement %v has no %v", st, part.pred)
+		}
+		*part.node = nodes[0]
+	}
+	return tr, nil
+}
+
+// retractStatement deletes the reified statement st of the triple tr, and
+// the triple, unless it is also reified by other statements.
+func (m *metadataService) retractStatement(st rdf.Node, tr rdf.Triple) error {
+	other := rdf.NewVariable("st")
+	sts, err := selectNodes(m.triplestore, other,
+		rdf.TriplePattern{other, rdfSubject, tr.Subject},
+		rdf.TriplePattern{other, rdfPredicate, tr.Predicate},
+		rdf.TriplePattern{other, rdfObject, tr.Object})
+	if err != nil {
+		return err
+	}
+	keepTriple := false
+	for _, n := range sts {
+		if n != st {
+			keepTriple = true
+			break
+		}
+	}
+	var (
+		subj = rdf.NewVariable("s")
+		pred = rdf.NewVariable("p")
+		obj  = rdf.NewVariable("o")
+	)
+	if !keepTriple {
+		where := []rdf.TriplePattern{
+			{st, rdfSubject, subj},
+			{st, rdfPredicate, pred},
+			{st, rdfObject, obj},
+		}
+		if _, _, err := m.triplestore.Update([]rdf.TriplePattern{{subj, pred, obj}}, nil, where); err != nil {
+			return err
+		}
+	}
+	reification := []rdf.TriplePattern{{st, pred, obj}}
+	_, _, err = m.triplestore.Update(reification, nil, reification)
+	return err
+}
+
+// retract deletes the statements ingested from the given source record, and
+// their reifications. A statement is only deleted if the record is its sole
+// source: the statements which are also ingested from other records, or
+// which were in the triplestore without provenance before the record was
+// ingested, like manual edits, are kept with their other reifications.
+func (m *metadataService) retract(s source, recordID string) error {
+	sts, err := selectNodes(m.triplestore, rdf.NewVariable("st"), recordStatement(s, recordID)...)
+	if err != nil {
+		return err
+	}
+	for _, st := range sts {
+		tr, err := m.reifiedTriple(st)
+		if err != nil {
+			return err
+		}
+		if err := m.retractStatement(st, tr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"github.com/knakk/kbp/rdf/memory"
+)
+
+func TestReify(t *testing.T) {
+	trs, err := reify(mustDecode(`<p> <hasMainTitle> "Sult" .`),
+		provenance{source: sourceOria, recordID: "1", time: time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := memory.NewGraph()
+	got.Insert(trs...)
+	want := mustDecode(`
+<p> <hasMainTitle> "Sult" .
+[] a <http://www.w3.org/1999/02/22-rdf-syntax-ns#Statement> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#subject> <p> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#predicate> <hasMainTitle> ;
+	<http://www.w3.org/1999/02/22-rdf-syntax-ns#object> "Sult" ;
+	<hasSource> <source/oria> ;
+	<hasSourceRecordID> "1" ;
+	<hasIngestTime> "2017-03-01T12:00:00Z"^^<http://www.w3.org/2001/XMLSchema#dateTime> .`)
+	if !got.Eq(want) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(want))
+	}
+}
+
+func TestRetract(t *testing.T) {
+	m := &metadataService{triplestore: mustDecode(`
+<p> <hasNote> "manual" ;
+	<hasSubtitle> "roman" .`)}
+	store := func(s source, recordID, data string) {
+		if err := m.insertIngested(mustDecode(data), provenance{source: s, recordID: recordID, time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordValues := func(s source, recordID, p string) []rdf.Node {
+		where := recordStatement(s, recordID)
+		where[3].Object = rdf.NewNamedNode(p)
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("o"), where...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodes
+	}
+	values := func(s, p string) []rdf.Node {
+		nodes, err := selectNodes(m.triplestore, rdf.NewVariable("o"),
+			rdf.TriplePattern{rdf.NewNamedNode(s), rdf.NewNamedNode(p), rdf.NewVariable("o")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodes
+	}
+
+	store(sourceOria, "1", `
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<hasSubtitle> "roman" ;
+	<hasNumPages> "219"^^<http://www.w3.org/2001/XMLSchema#int> ;
+	<isPublicationOf> <w> .
+<w> a <Work> ;
+	<hasName> "Sullt" ;
+	<hasFirstPublicationDate> [ a <Date> ; <hasYear> "1890"^^<http://www.w3.org/2001/XMLSchema#int> ] .`)
+	store(sourceNasjonalbiblioteket, "x", `<p> <hasMainTitle> "Sult" .`)
+
+	if p, ok, err := m.recordPublication(sourceOria, "1"); err != nil || !ok || p != rdf.NewNamedNode("p") {
+		t.Errorf("recordPublication => %v, %v, %v; want <p>", p, ok, err)
+	}
+
+	// Re-ingest from Oria, where the name of the Work is corrected.
+	if err := m.retract(sourceOria, "1"); err != nil {
+		t.Fatal(err)
+	}
+	store(sourceOria, "1", `
+<p> <hasMainTitle> "Sult!" ;
+	<isPublicationOf> <w> .
+<w> a <Work> ;
+	<hasName> "Sult" .`)
+
+	if got := values("p", "hasNumPages"); len(got) != 0 {
+		t.Errorf("retracted statement kept: <p> <hasNumPages> %v", got)
+	}
+	if got := values("p", "hasNote"); len(got) != 1 {
+		t.Error("manual statement <p> <hasNote> retracted")
+	}
+	if got := values("p", "hasMainTitle"); len(got) != 2 {
+		t.Errorf("got titles %v; want the one from Nasjonalbiblioteket and the new one from Oria", got)
+	}
+	if got := recordValues(sourceNasjonalbiblioteket, "x", "hasMainTitle"); len(got) != 1 {
+		t.Errorf("got titles %v from Nasjonalbiblioteket; want its provenance kept", got)
+	}
+	if got := values("w", "hasName"); len(got) != 1 || got[0] != rdf.NewStrLiteral("Sult") {
+		t.Errorf("got names %v of Work; want the corrected name", got)
+	}
+	if got := recordValues(sourceOria, "1", "hasName"); len(got) != 1 {
+		t.Errorf("got names %v from Oria; want the provenance of the Work kept", got)
+	}
+	if got := values("w", "hasFirstPublicationDate"); len(got) != 0 {
+		t.Errorf("retracted statement kept: <w> <hasFirstPublicationDate> %v", got)
+	}
+
+	// The record is deleted in Oria.
+	if err := m.retract(sourceOria, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := values("p", "hasMainTitle"); len(got) != 1 {
+		t.Errorf("got titles %v; want the one from Nasjonalbiblioteket", got)
+	}
+	if got := values("p", "hasSubtitle"); len(got) != 1 {
+		t.Error("manual statement <p> <hasSubtitle>, also ingested from Oria, retracted")
+	}
+	if got := recordValues(sourceOria, "1", "hasSubtitle"); len(got) != 0 {
+		t.Errorf("got subtitles %v from Oria; want none", got)
+	}
+	if got := values("w", "hasName"); len(got) != 0 {
+		t.Errorf("got names %v of Work only described by the deleted record; want none", got)
+	}
+	if _, ok, _ := m.recordPublication(sourceOria, "1"); ok {
+		t.Error("publication of deleted record still found")
+	}
+}
+
+func TestDescribeWithoutProvenance(t *testing.T) {
+	m := &metadataService{triplestore: memory.NewGraph()}
+	const data = `
+<p> a <Publication> ;
+	<hasMainTitle> "Sult" ;
+	<isPublicationOf> <w> .`
+	if err := m.insertIngested(mustDecode(data), provenance{source: sourceOria, recordID: "1", time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.describe(rdf.DescSymmetricRecursive, rdf.NewNamedNode("p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustDecode(data); !got.Eq(want) {
+		t.Errorf("got:\n%v\nwant:\n%v", mustEncode(got), mustEncode(want))
+	}
+}
@@ -49,6 +49,13 @@ func (s *searchService) indexResourceFromGraph(uri rdf.NamedNode, g *memory.Grap
 		}
 		p.Process()
 		e = &p
+	case entity.TypeCorporation:
+		var c entity.Corporation
+		if err := g.Decode(&c, uri, rdf.NewNamedNode(""), s.langs); err != nil {
+			return fmt.Errorf("indexResourceFromGraph decode %s as Corporation error: %v", uri, err)
+		}
+		c.Process()
+		e = &c
 	/*case entity.TypePublication:
 	var p entity.PublicationWithWork
 	if err := g.Decode(&p, uri, rdf.NewNamedNode("")); err != nil {
@@ -64,7 +71,9 @@ func (s *searchService) indexResourceFromGraph(uri rdf.NamedNode, g *memory.Grap
 		w.Process()
 		e = &w
 	default:
-		panic("TODO indexResourceFromGraph " + entity.TypeFromURI(uri).String())
+		// Only agents and works are searchable; other resources, like
+		// topics and places, are found through them.
+		return nil
 	}
 
 	d := doc{
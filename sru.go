@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpGetter performs the HTTP requests of the SRU and OAI-PMH clients.
+// It is satisfied by *http.Client.
+type httpGetter interface {
+	Get(url string) (*http.Response, error)
+}
+
+// sruClient is a client for a SRU (Search/Retrieve via URL) endpoint,
+// like the one of Oria:
+// https://bibsys.alma.exlibrisgroup.com/view/sru/47BIBSYS_NETWORK
+type sruClient struct {
+	endpoint     string
+	version      string
+	recordSchema string
+
+	// isbnIndex is the CQL index used to search by ISBN.
+	isbnIndex string
+
+	// pageSize is the number of records requested per searchRetrieve
+	// (maximumRecords).
+	pageSize int
+
+	transport httpGetter
+}
+
+func newSRUClient(endpoint string) *sruClient {
+	return &sruClient{
+		endpoint:     endpoint,
+		version:      "1.2",
+		recordSchema: "marcxml",
+		isbnIndex:    "alma.isbn",
+		pageSize:     50,
+		transport:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// cqlTerm returns s as a CQL search term, quoted if needed.
+func cqlTerm(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"()=<>/\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// cqlAnd returns a CQL query matching the given index and term pairs,
+// like cqlAnd("alma.title", "Sult", "alma.creator", "Hamsun").
+func cqlAnd(indexTerms ...string) string {
+	var clauses []string
+	for i := 0; i+1 < len(indexTerms); i += 2 {
+		clauses = append(clauses, indexTerms[i]+"="+cqlTerm(indexTerms[i+1]))
+	}
+	return strings.Join(clauses, " and ")
+}
+
+// sruResponse is a searchRetrieve response.
+type sruResponse struct {
+	NumberOfRecords    int             `xml:"numberOfRecords"`
+	Records            []sruRecord     `xml:"records>record"`
+	NextRecordPosition int             `xml:"nextRecordPosition"`
+	Diagnostics        []sruDiagnostic `xml:"diagnostics>diagnostic"`
+}
+
+// sruRecord is a record in a searchRetrieve response.
+type sruRecord struct {
+	Schema   string `xml:"recordSchema"`
+	Position int    `xml:"recordPosition"`
+	Data     struct {
+		XML []byte `xml:",innerxml"`
+	} `xml:"recordData"`
+}
+
+// sruDiagnostic is a diagnostic (error or warning) in a SRU response.
+type sruDiagnostic struct {
+	URI     string `xml:"uri"`
+	Details string `xml:"details"`
+	Message string `xml:"message"`
+}
+
+func (d sruDiagnostic) Error() string {
+	msg := d.Message
+	if msg == "" {
+		msg = d.URI
+	}
+	if d.Details != "" {
+		msg += ": " + d.Details
+	}
+	return "sru: " + msg
+}
+
+// errSRUNotFound is returned when a search has no records.
+var errSRUNotFound = errors.New("sru: no records found")
+
+// searchRetrieve fetches the page of records matching the CQL query,
+// starting at position start (counting from 1). A response with
+// diagnostics and no records is returned as an error, being the
+// first sruDiagnostic.
+func (c *sruClient) searchRetrieve(query string, start int) (*sruResponse, error) {
+	params := url.Values{
+		"version":        {c.version},
+		"operation":      {"searchRetrieve"},
+		"query":          {query},
+		"recordSchema":   {c.recordSchema},
+		"startRecord":    {strconv.Itoa(start)},
+		"maximumRecords": {strconv.Itoa(c.pageSize)},
+	}
+	resp, err := c.transport.Get(c.endpoint + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res sruResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("sru: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("sru: error decoding response: %v", err)
+	}
+	if len(res.Records) == 0 && len(res.Diagnostics) > 0 {
+		return nil, res.Diagnostics[0]
+	}
+	return &res, nil
+}
+
+// search calls fn with the record data of every record matching the CQL
+// query, fetching as many pages as needed. It stops at the first error
+// returned by fn.
+func (c *sruClient) search(query string, fn func(data []byte) error) error {
+	for start := 1; ; {
+		res, err := c.searchRetrieve(query, start)
+		if err != nil {
+			return err
+		}
+		for _, rec := range res.Records {
+			if err := fn(rec.Data.XML); err != nil {
+				return err
+			}
+		}
+		if res.NextRecordPosition <= start || len(res.Records) == 0 {
+			return nil
+		}
+		start = res.NextRecordPosition
+	}
+}
+
+// fetchISBN returns the record data of the first record with the given ISBN.
+func (c *sruClient) fetchISBN(isbn string) ([]byte, error) {
+	isbn, ok := normalizeISBN(isbn)
+	if !ok {
+		return nil, errors.New("sru: invalid ISBN")
+	}
+	res, err := c.searchRetrieve(cqlAnd(c.isbnIndex, isbn), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Records) == 0 {
+		return nil, errSRUNotFound
+	}
+	return res.Records[0].Data.XML, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+func TestCQL(t *testing.T) {
+	tests := []struct {
+		input []string
+		want  string
+	}{
+		{[]string{"alma.isbn", "9788205307186"}, `alma.isbn=9788205307186`},
+		{[]string{"alma.title", "Sult og kjærlighet"}, `alma.title="Sult og kjærlighet"`},
+		{[]string{"alma.title", `"Sult"`}, `alma.title="\"Sult\""`},
+		{[]string{"alma.creator", "Hamsun", "alma.title", "Sult"}, `alma.creator=Hamsun and alma.title=Sult`},
+	}
+
+	for _, test := range tests {
+		if got := cqlAnd(test.input...); got != test.want {
+			t.Errorf("cqlAnd(%q) => %s; want %s", test.input, got, test.want)
+		}
+	}
+}
+
+// sruTestServer serves n records, with the record number as the title.
+func sruTestServer(t *testing.T, n int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("operation") != "searchRetrieve" || q.Get("version") != "1.2" || q.Get("recordSchema") != "marcxml" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if q.Get("query") == "alma.isbn=0000000000" {
+			fmt.Fprint(w, `<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/">
+  <version>1.2</version>
+  <numberOfRecords>0</numberOfRecords>
+</searchRetrieveResponse>`)
+			return
+		}
+		start, _ := strconv.Atoi(q.Get("startRecord"))
+		max, _ := strconv.Atoi(q.Get("maximumRecords"))
+		fmt.Fprintf(w, `<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/">
+  <version>1.2</version>
+  <numberOfRecords>%d</numberOfRecords>
+  <records>`, n)
+		i := start
+		for ; i < start+max && i <= n; i++ {
+			fmt.Fprintf(w, `
+    <record>
+      <recordSchema>marcxml</recordSchema>
+      <recordPacking>xml</recordPacking>
+      <recordData><record xmlns=""><leader>00715cam a2200241 c 4500</leader><datafield tag="245" ind1="1" ind2="0"><subfield code="a">%d</subfield></datafield></record></recordData>
+      <recordPosition>%d</recordPosition>
+    </record>`, i, i)
+		}
+		fmt.Fprint(w, `
+  </records>`)
+		if i <= n {
+			fmt.Fprintf(w, `
+  <nextRecordPosition>%d</nextRecordPosition>`, i)
+		}
+		fmt.Fprint(w, `
+</searchRetrieveResponse>`)
+	}))
+}
+
+func TestSRUSearchPaging(t *testing.T) {
+	srv := sruTestServer(t, 7)
+	defer srv.Close()
+	c := newSRUClient(srv.URL)
+	c.pageSize = 3
+
+	var titles []string
+	err := c.search(cqlAnd("alma.creator", "Hamsun"), func(data []byte) error {
+		g, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewReader(data), sourceOria)
+		if err != nil {
+			return err
+		}
+		var p struct {
+			Title string `rdf:"->hasMainTitle"`
+		}
+		if err := g.Decode(&p, rdf.NewNamedNode("p"), rdf.NewNamedNode(""), nil); err != nil {
+			return err
+		}
+		titles = append(titles, p.Title)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(titles) != "[1 2 3 4 5 6 7]" {
+		t.Errorf("got titles %v; want [1 2 3 4 5 6 7]", titles)
+	}
+}
+
+func TestSRUFetchISBN(t *testing.T) {
+	srv := sruTestServer(t, 3)
+	defer srv.Close()
+	c := newSRUClient(srv.URL)
+
+	// The first of the records with the ISBN is ingested.
+	data, err := c.fetchISBN("978-82-05-30718-6")
+	if err != nil {
+		t.Fatalf("fetchISBN: %v", err)
+	}
+	g, err := ingestPublication(rdf.NewNamedNode("p"), bytes.NewReader(data), sourceOria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p struct {
+		Title string `rdf:"->hasMainTitle"`
+	}
+	if err := g.Decode(&p, rdf.NewNamedNode("p"), rdf.NewNamedNode(""), nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "1" {
+		t.Errorf("got title %q; want the first record", p.Title)
+	}
+	if _, err := c.fetchISBN("0000000000"); err != errSRUNotFound {
+		t.Errorf("fetchISBN of unknown ISBN: got error %v; want %v", err, errSRUNotFound)
+	}
+}
+
+// httpGetterFunc lets a function be used as an httpGetter.
+type httpGetterFunc func(url string) (*http.Response, error)
+
+func (f httpGetterFunc) Get(url string) (*http.Response, error) { return f(url) }
+
+func TestSRUDiagnostics(t *testing.T) {
+	c := newSRUClient("http://sru.test")
+	c.transport = httpGetterFunc(func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body: ioutil.NopCloser(bytes.NewBufferString(`<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/">
+  <version>1.2</version>
+  <numberOfRecords>0</numberOfRecords>
+  <diagnostics>
+    <diagnostic xmlns="http://www.loc.gov/zing/srw/diagnostic/">
+      <uri>info:srw/diagnostic/1/16</uri>
+      <details>alma.unknown</details>
+      <message>Unsupported index</message>
+    </diagnostic>
+  </diagnostics>
+</searchRetrieveResponse>`)),
+		}, nil
+	})
+
+	_, err := c.searchRetrieve("alma.unknown=x", 1)
+	d, ok := err.(sruDiagnostic)
+	if !ok {
+		t.Fatalf("got error %v; want sruDiagnostic", err)
+	}
+	if d.URI != "info:srw/diagnostic/1/16" || d.Error() != "sru: Unsupported index: alma.unknown" {
+		t.Errorf("got diagnostic %+v; %q", d, d.Error())
+	}
+
+	c.transport = httpGetterFunc(func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Body:       ioutil.NopCloser(bytes.NewBufferString("down for maintenance")),
+		}, nil
+	})
+	if _, err := c.searchRetrieve("alma.isbn=1", 1); err == nil || err.Error() != "sru: 503 Service Unavailable" {
+		t.Errorf("got error %v; want sru: 503 Service Unavailable", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "github.com/knakk/kbp/rdf"
+
+// vocabularyTerm is a resource in a controlled vocabulary, which ingested
+// data can link to, with its names by language.
+type vocabularyTerm struct {
+	uri   string
+	names map[string]string
+}
+
+// vocabulary holds the controlled vocabularies by class.
+var vocabulary = map[string][]vocabularyTerm{
+	"LiteraryForm": {
+		{"form/biography", map[string]string{"no": "biografi", "en": "biography"}},
+		{"form/drama", map[string]string{"no": "drama", "en": "drama"}},
+		{"form/essay", map[string]string{"no": "essay", "en": "essay"}},
+		{"form/fiction", map[string]string{"no": "skjønnlitteratur", "en": "fiction"}},
+		{"form/humor", map[string]string{"no": "humor", "en": "humor"}},
+		{"form/letters", map[string]string{"no": "brev", "en": "letters"}},
+		{"form/mixed", map[string]string{"no": "blandede former", "en": "mixed forms"}},
+		{"form/nonfiction", map[string]string{"no": "faglitteratur", "en": "nonfiction"}},
+		{"form/novel", map[string]string{"no": "roman", "en": "novel"}},
+		{"form/poetry", map[string]string{"no": "lyrikk", "en": "poetry"}},
+		{"form/shortstory", map[string]string{"no": "noveller", "en": "short stories"}},
+		{"form/speech", map[string]string{"no": "taler", "en": "speeches"}},
+	},
+	"Source": {
+		{"source/google", map[string]string{"no": "Google Books", "en": "Google Books"}},
+		{"source/librarything", map[string]string{"no": "LibraryThing", "en": "LibraryThing"}},
+		{"source/loc", map[string]string{"no": "Library of Congress", "en": "Library of Congress"}},
+		{"source/nb", map[string]string{"no": "Nasjonalbiblioteket", "en": "National Library of Norway"}},
+		{"source/openlibrary", map[string]string{"no": "Open Library", "en": "Open Library"}},
+		{"source/oria", map[string]string{"no": "Oria", "en": "Oria"}},
+	},
+}
+
+// vocabularyTriples returns the triples describing all the
+// resources in the controlled vocabularies.
+func vocabularyTriples() []rdf.Triple {
+	var trs []rdf.Triple
+	for class, terms := range vocabulary {
+		for _, term := range terms {
+			uri := rdf.NewNamedNode(term.uri)
+			trs = append(trs, rdf.Triple{uri, rdf.RDFtype, rdf.NewNamedNode(class)})
+			for lang, name := range term.names {
+				trs = append(trs, rdf.Triple{uri, rdf.NewNamedNode("hasName"), rdf.NewLangLiteral(name, lang)})
+			}
+		}
+	}
+	return trs
+}